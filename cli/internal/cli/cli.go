@@ -1,10 +1,12 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/sammanbajracharya/drift_cli/internal/core"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
 	"github.com/urfave/cli/v2"
 )
 
@@ -42,13 +44,20 @@ func (a *App) Run() error {
 			{
 				Name:  "add",
 				Usage: "Add a file or folder to the Drift repository",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Add files even if they are ignored",
+						Aliases: []string{"f"},
+					},
+				},
 				Action: func(c *cli.Context) error {
 					path := c.Args().First()
 					if path == "" {
 						return cli.Exit("Please specify a file or folder to add", 1)
 					}
 					ctx := &core.Context{}
-					if err := ctx.Add(path); err != nil {
+					if err := ctx.Add(path, c.Bool("force")); err != nil {
 						return err
 					}
 					return cli.Exit("Added "+path+" to Drift repository", 0)
@@ -57,29 +66,1027 @@ func (a *App) Run() error {
 			{
 				Name:  "status",
 				Usage: "Show the status of the Drift repository",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "short",
+						Usage:   "Show one line per changed path",
+						Aliases: []string{"s"},
+					},
+					&cli.BoolFlag{
+						Name:  "porcelain",
+						Usage: "Stable, uncolored short output for scripts",
+					},
+					&cli.BoolFlag{
+						Name:    "branch",
+						Usage:   "Show branch and tracking information in short output",
+						Aliases: []string{"b"},
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
 				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
 					ctx := &core.Context{}
-					if err := ctx.Status(); err != nil {
+					opts := core.StatusOptions{
+						Short:     c.Bool("short"),
+						Porcelain: c.Bool("porcelain"),
+						Branch:    c.Bool("branch"),
+						Color:     color,
+					}
+					if err := ctx.Status(opts); err != nil {
 						return err
 					}
+					if opts.Short || opts.Porcelain {
+						return nil
+					}
 					return cli.Exit("Drift repository status displayed", 0)
 				},
 			},
 			{
 				Name:  "commit",
 				Usage: "Commit changes to the Drift repository",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "author",
+						Usage: "Override the commit author (\"Name <email>\")",
+					},
+					&cli.StringFlag{
+						Name:  "date",
+						Usage: "Override the author date",
+					},
+					&cli.BoolFlag{
+						Name:    "all",
+						Usage:   "Stage modified and deleted tracked files before committing",
+						Aliases: []string{"a"},
+					},
+				},
 				Action: func(c *cli.Context) error {
 					msg := c.Args().First()
 					if msg == "" {
 						return cli.Exit("Aborting commit due to empty commit message", 1)
 					}
 					ctx := &core.Context{}
-					if err := ctx.Commit(msg); err != nil {
-						return err
+					opts := core.CommitOptions{
+						Author: c.String("author"),
+						Date:   c.String("date"),
+						All:    c.Bool("all"),
+					}
+					if err := ctx.Commit(msg, opts); err != nil {
+						return cli.Exit(err.Error(), 1)
 					}
 					return cli.Exit("Changes committed to Drift repository", 0)
 				},
 			},
+			{
+				Name:      "log",
+				Usage:     "Show commit history starting from HEAD",
+				ArgsUsage: "[<revision-range>...]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "oneline",
+						Usage: "Show each commit on a single line",
+					},
+					&cli.IntFlag{
+						Name:    "max-count",
+						Usage:   "Limit the number of commits to show",
+						Aliases: []string{"n"},
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Show commits more recent than a date",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "Show commits older than a date",
+					},
+					&cli.StringFlag{
+						Name:  "author",
+						Usage: "Show commits whose author matches a pattern",
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					opts := core.LogOptions{
+						Oneline:  c.Bool("oneline"),
+						MaxCount: c.Int("max-count"),
+						Author:   c.String("author"),
+						Revs:     c.Args().Slice(),
+						Color:    color,
+					}
+					if since := c.String("since"); since != "" {
+						t, err := utils.ParseDate(since)
+						if err != nil {
+							return cli.Exit("Invalid --since date: "+err.Error(), 1)
+						}
+						opts.Since = t
+					}
+					if until := c.String("until"); until != "" {
+						t, err := utils.ParseDate(until)
+						if err != nil {
+							return cli.Exit("Invalid --until date: "+err.Error(), 1)
+						}
+						opts.Until = t
+					}
+
+					ctx := &core.Context{}
+					if err := ctx.Log(opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "ls-tree",
+				Usage:     "List the contents of a tree object",
+				ArgsUsage: "<tree-ish>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "r",
+						Usage: "Recurse into subtrees",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					treeish := c.Args().First()
+					if treeish == "" {
+						return cli.Exit("Please specify a tree-ish", 1)
+					}
+					ctx := &core.Context{}
+					if err := ctx.LsTree(treeish, c.Bool("r")); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "branch",
+				Usage:     "List, create, rename or delete branches",
+				ArgsUsage: "[<name> [<start>]]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "delete",
+						Usage:   "Delete a fully merged branch",
+						Aliases: []string{"d"},
+					},
+					&cli.BoolFlag{
+						Name:  "D",
+						Usage: "Delete a branch even if it is not merged",
+					},
+					&cli.BoolFlag{
+						Name:    "move",
+						Usage:   "Rename a branch",
+						Aliases: []string{"m"},
+					},
+					&cli.StringFlag{
+						Name:    "set-upstream-to",
+						Usage:   "Track <peer>/<branch> (or a local branch) as the upstream",
+						Aliases: []string{"u"},
+					},
+					&cli.BoolFlag{
+						Name:  "unset-upstream",
+						Usage: "Stop tracking an upstream",
+					},
+					&cli.BoolFlag{
+						Name:    "remotes",
+						Usage:   "List remote-tracking branches",
+						Aliases: []string{"r"},
+					},
+					&cli.BoolFlag{
+						Name:    "all",
+						Usage:   "List local and remote-tracking branches",
+						Aliases: []string{"a"},
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					args := c.Args()
+					var err error
+					switch {
+					case c.Bool("delete") || c.Bool("D"):
+						if args.Len() == 0 {
+							return cli.Exit("Please specify a branch to delete", 1)
+						}
+						for _, name := range args.Slice() {
+							if err = ctx.DeleteBranch(name, c.Bool("D")); err != nil {
+								break
+							}
+						}
+					case c.Bool("move"):
+						switch args.Len() {
+						case 1:
+							err = ctx.RenameBranch("", args.Get(0))
+						case 2:
+							err = ctx.RenameBranch(args.Get(0), args.Get(1))
+						default:
+							return cli.Exit("Usage: drift branch -m [<old>] <new>", 1)
+						}
+					case c.IsSet("set-upstream-to"):
+						err = ctx.SetUpstream(args.Get(0), c.String("set-upstream-to"))
+					case c.Bool("unset-upstream"):
+						err = ctx.UnsetUpstream(args.Get(0))
+					case args.Len() > 0:
+						err = ctx.CreateBranch(args.Get(0), args.Get(1))
+					default:
+						var color bool
+						if color, err = useColor(c.String("color")); err != nil {
+							break
+						}
+						err = ctx.ListBranches(core.BranchListOptions{
+							Remotes: c.Bool("remotes"),
+							All:     c.Bool("all"),
+							Color:   color,
+						})
+					}
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "checkout",
+				Usage:     "Switch branches or check out a commit",
+				ArgsUsage: "<branch|commit>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Discard local changes",
+						Aliases: []string{"f"},
+					},
+					&cli.StringFlag{
+						Name:  "b",
+						Usage: "Create a new branch and switch to it",
+					},
+					&cli.BoolFlag{
+						Name:  "detach",
+						Usage: "Detach HEAD at the named commit",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					target := c.Args().First()
+					if target == "" && c.String("b") == "" {
+						return cli.Exit("Please specify a branch or commit to check out", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.CheckoutOptions{
+						Force:     c.Bool("force"),
+						NewBranch: c.String("b"),
+						Detach:    c.Bool("detach"),
+					}
+					if err := ctx.Checkout(target, opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "switch",
+				Usage:     "Switch branches",
+				ArgsUsage: "<branch>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Discard local changes",
+						Aliases: []string{"f"},
+					},
+					&cli.StringFlag{
+						Name:    "create",
+						Usage:   "Create a new branch and switch to it",
+						Aliases: []string{"c"},
+					},
+					&cli.BoolFlag{
+						Name:  "detach",
+						Usage: "Detach HEAD at the named commit",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					target := c.Args().First()
+					if target == "" && c.String("create") == "" {
+						return cli.Exit("Please specify a branch to switch to", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.CheckoutOptions{
+						Force:     c.Bool("force"),
+						NewBranch: c.String("create"),
+						Detach:    c.Bool("detach"),
+					}
+					if err := ctx.Switch(target, opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "merge",
+				Usage:     "Join another branch into the current one",
+				ArgsUsage: "<branch|commit>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "abort",
+						Usage: "Abort the current merge and restore the pre-merge state",
+					},
+					&cli.BoolFlag{
+						Name:  "continue",
+						Usage: "Conclude a merge once conflicts are resolved",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					var err error
+					switch {
+					case c.Bool("abort"):
+						err = ctx.MergeAbort()
+					case c.Bool("continue"):
+						err = ctx.MergeContinue()
+					case c.Args().First() == "":
+						return cli.Exit("Please specify a branch or commit to merge", 1)
+					default:
+						err = ctx.Merge(c.Args().First())
+					}
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Show changes between the working tree, the index and commits",
+				ArgsUsage: "[<commit> [<commit>] | <commit>..<commit> | <commit>...<commit>]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "staged",
+						Usage:   "Compare the index against HEAD",
+						Aliases: []string{"cached"},
+					},
+					&cli.BoolFlag{
+						Name:  "stat",
+						Usage: "Show a diffstat instead of the patch",
+					},
+					&cli.BoolFlag{
+						Name:  "name-only",
+						Usage: "Show only the names of changed files",
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					if c.Args().Len() > 2 {
+						return cli.Exit("Usage: drift diff [<commit> [<commit>]]", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.DiffOptions{
+						Staged:   c.Bool("staged"),
+						Stat:     c.Bool("stat"),
+						NameOnly: c.Bool("name-only"),
+						Color:    color,
+						Revs:     c.Args().Slice(),
+					}
+					if err := ctx.Diff(opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "check-ignore",
+				Usage:     "Show which paths are excluded by .driftignore rules",
+				ArgsUsage: "<path>...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "verbose",
+						Usage:   "Show the pattern that matched each path",
+						Aliases: []string{"v"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() == 0 {
+						return cli.Exit("Please specify at least one path", 1)
+					}
+					ctx := &core.Context{}
+					ignored, err := ctx.CheckIgnore(c.Args().Slice(), c.Bool("verbose"))
+					if err != nil {
+						return cli.Exit(err.Error(), 128)
+					}
+					if !ignored {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "gc",
+				Usage: "Remove unreachable objects from the object store",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Usage:   "Report what would be removed without deleting anything",
+						Aliases: []string{"n"},
+					},
+					&cli.StringFlag{
+						Name:  "prune",
+						Usage: "Only prune unreachable objects older than this date",
+						Value: "2 weeks ago",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					before, err := utils.ParseDate(c.String("prune"))
+					if err != nil {
+						return cli.Exit("Invalid --prune date: "+err.Error(), 1)
+					}
+					ctx := &core.Context{}
+					opts := core.GCOptions{
+						DryRun:      c.Bool("dry-run"),
+						PruneBefore: before,
+					}
+					if err := ctx.GC(opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "repack",
+				Usage: "Pack reachable objects into a single delta-compressed pack file",
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					if err := ctx.Repack(); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "pack-refs",
+				Usage: "Move loose tags, or all refs, into a single packed-refs file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Pack branches and other refs as well as tags",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					if err := ctx.PackRefs(c.Bool("all")); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "fsck",
+				Usage: "Verify the integrity of the object store and refs",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Print the report as JSON",
+					},
+					&cli.BoolFlag{
+						Name:  "no-dangling",
+						Usage: "Do not report objects that nothing refers to",
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 128)
+					}
+					ctx := &core.Context{}
+					opts := core.FsckOptions{
+						JSON:       c.Bool("json"),
+						NoDangling: c.Bool("no-dangling"),
+						Color:      color,
+					}
+					ok, err := ctx.Fsck(opts)
+					if err != nil {
+						return cli.Exit(err.Error(), 128)
+					}
+					if !ok {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "Restore working tree files or index entries",
+				ArgsUsage: "<path>...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "source",
+						Usage:   "Restore from this commit instead of the index (or HEAD with --staged)",
+						Aliases: []string{"s"},
+					},
+					&cli.BoolFlag{
+						Name:    "staged",
+						Usage:   "Restore the index",
+						Aliases: []string{"S"},
+					},
+					&cli.BoolFlag{
+						Name:    "worktree",
+						Usage:   "Restore the working tree (the default unless --staged is given)",
+						Aliases: []string{"W"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() == 0 {
+						return cli.Exit("Please specify at least one path to restore", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.RestoreOptions{
+						Source:   c.String("source"),
+						Staged:   c.Bool("staged"),
+						Worktree: c.Bool("worktree"),
+					}
+					if err := ctx.Restore(c.Args().Slice(), opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "Remove files from the working tree and the index",
+				ArgsUsage: "<path>...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "cached",
+						Usage: "Only remove from the index, keeping the working file",
+					},
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Usage:   "Allow recursive removal when a directory is given",
+						Aliases: []string{"r"},
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Remove even if the file has staged or local changes",
+						Aliases: []string{"f"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() == 0 {
+						return cli.Exit("Please specify at least one path to remove", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.RmOptions{
+						Cached:    c.Bool("cached"),
+						Recursive: c.Bool("recursive"),
+						Force:     c.Bool("force"),
+					}
+					if err := ctx.Rm(c.Args().Slice(), opts); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "tag",
+				Usage:     "List, create or delete tags",
+				ArgsUsage: "[<name> [<commit>]]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "annotate",
+						Usage:   "Create an annotated tag object",
+						Aliases: []string{"a"},
+					},
+					&cli.StringFlag{
+						Name:    "message",
+						Usage:   "Tag message (implies -a)",
+						Aliases: []string{"m"},
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "Replace an existing tag",
+						Aliases: []string{"f"},
+					},
+					&cli.BoolFlag{
+						Name:    "delete",
+						Usage:   "Delete tags",
+						Aliases: []string{"d"},
+					},
+					&cli.BoolFlag{
+						Name:    "list",
+						Usage:   "List tags matching the given patterns",
+						Aliases: []string{"l"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					args := c.Args()
+					var err error
+					switch {
+					case c.Bool("delete"):
+						if args.Len() == 0 {
+							return cli.Exit("Please specify a tag to delete", 1)
+						}
+						for _, name := range args.Slice() {
+							if err = ctx.DeleteTag(name); err != nil {
+								break
+							}
+						}
+					case c.Bool("list") || args.Len() == 0:
+						err = ctx.ListTags(args.Slice())
+					default:
+						opts := core.TagOptions{
+							Message:   c.String("message"),
+							Annotated: c.Bool("annotate"),
+							Force:     c.Bool("force"),
+						}
+						err = ctx.CreateTag(args.Get(0), args.Get(1), opts)
+					}
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "describe",
+				Usage:     "Name a commit after the nearest tag it descends from",
+				ArgsUsage: "[<commit>]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "tags",
+						Usage: "Use lightweight tags as well as annotated ones",
+					},
+					&cli.BoolFlag{
+						Name:  "always",
+						Usage: "Show the abbreviated commit id when no tag is found",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ctx := &core.Context{}
+					opts := core.DescribeOptions{
+						Tags:   c.Bool("tags"),
+						Always: c.Bool("always"),
+					}
+					if err := ctx.Describe(c.Args().First(), opts); err != nil {
+						return cli.Exit(err.Error(), 128)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "rev-parse",
+				Usage:     "Print the object ids that revisions resolve to",
+				ArgsUsage: "<revision>...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "short",
+						Usage: "Abbreviate object ids",
+					},
+					&cli.BoolFlag{
+						Name:  "verify",
+						Usage: "Resolve exactly one revision and reject ranges",
+					},
+					&cli.BoolFlag{
+						Name:  "abbrev-ref",
+						Usage: "Print the short ref name instead of the object id",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() == 0 {
+						return cli.Exit("Please specify at least one revision", 1)
+					}
+					ctx := &core.Context{}
+					opts := core.RevParseOptions{
+						Short:     c.Bool("short"),
+						Verify:    c.Bool("verify"),
+						AbbrevRef: c.Bool("abbrev-ref"),
+					}
+					if err := ctx.RevParse(c.Args().Slice(), opts); err != nil {
+						return cli.Exit(err.Error(), 128)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "reflog",
+				Usage:     "Show or expire the history of ref updates",
+				ArgsUsage: "[show [<ref>] | expire [<ref>...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					ctx := &core.Context{}
+					if err := ctx.ReflogShow(c.Args().First(), core.ReflogShowOptions{Color: color}); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "List the reflog of a ref, HEAD by default",
+						ArgsUsage: "[<ref>]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "color",
+								Usage: "Colorize output: auto, always or never",
+								Value: "auto",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							color, err := useColor(c.String("color"))
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							ctx := &core.Context{}
+							if err := ctx.ReflogShow(c.Args().First(), core.ReflogShowOptions{Color: color}); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "expire",
+						Usage:     "Drop old reflog entries",
+						ArgsUsage: "[<ref>...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "expire",
+								Usage: "Drop entries older than this date (default: 90 days ago)",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "Expire the reflogs of all refs",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							opts := core.ReflogExpireOptions{All: c.Bool("all")}
+							if expire := c.String("expire"); expire != "" {
+								t, err := utils.ParseDate(expire)
+								if err != nil {
+									return cli.Exit("Invalid --expire date: "+err.Error(), 1)
+								}
+								opts.Expire = t
+							}
+							ctx := &core.Context{}
+							if err := ctx.ReflogExpire(c.Args().Slice(), opts); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:      "media",
+				Usage:     "List, fetch and prune large files kept in the media store",
+				ArgsUsage: "[ls | fetch [<path>...] | prune]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Colorize output: auto, always or never",
+						Value: "auto",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					color, err := useColor(c.String("color"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					ctx := &core.Context{}
+					if err := ctx.MediaList(core.MediaListOptions{Color: color}); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:  "ls",
+						Usage: "List the files stored as media and whether their content is present",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "color",
+								Usage: "Colorize output: auto, always or never",
+								Value: "auto",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							color, err := useColor(c.String("color"))
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							ctx := &core.Context{}
+							if err := ctx.MediaList(core.MediaListOptions{Color: color}); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "fetch",
+						Usage:     "Fetch missing media from media.source and check it out",
+						ArgsUsage: "[<path>...]",
+						Action: func(c *cli.Context) error {
+							ctx := &core.Context{}
+							if err := ctx.MediaFetch(c.Args().Slice()); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "prune",
+						Usage: "Remove media that no commit, reflog or the index refers to",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "Report what would be removed without removing it",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							ctx := &core.Context{}
+							if err := ctx.MediaPrune(core.MediaPruneOptions{DryRun: c.Bool("dry-run")}); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:      "stash",
+				Usage:     "Shelve local changes and bring them back later",
+				ArgsUsage: "[push [-u] [-m <message>] | pop | apply | list | drop | show] [stash@{<n>}]",
+				Flags:     stashPushFlags(),
+				Action: func(c *cli.Context) error {
+					return stashPush(c)
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:   "push",
+						Usage:  "Save local changes as a new stash entry and reset to HEAD",
+						Flags:  stashPushFlags(),
+						Action: stashPush,
+					},
+					{
+						Name:      "pop",
+						Usage:     "Apply a stash entry and drop it if it applied cleanly",
+						ArgsUsage: "[stash@{<n>}]",
+						Action: func(c *cli.Context) error {
+							ctx := &core.Context{}
+							if err := ctx.StashApply(c.Args().First(), true); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "apply",
+						Usage:     "Apply a stash entry, keeping it on the stack",
+						ArgsUsage: "[stash@{<n>}]",
+						Action: func(c *cli.Context) error {
+							ctx := &core.Context{}
+							if err := ctx.StashApply(c.Args().First(), false); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the stash entries, newest first",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "color",
+								Usage: "Colorize output: auto, always or never",
+								Value: "auto",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							color, err := useColor(c.String("color"))
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							ctx := &core.Context{}
+							if err := ctx.StashList(core.StashListOptions{Color: color}); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "drop",
+						Usage:     "Remove a stash entry",
+						ArgsUsage: "[stash@{<n>}]",
+						Action: func(c *cli.Context) error {
+							ctx := &core.Context{}
+							if err := ctx.StashDrop(c.Args().First()); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "show",
+						Usage:     "Show the changes recorded in a stash entry",
+						ArgsUsage: "[stash@{<n>}]",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "patch",
+								Aliases: []string{"p"},
+								Usage:   "Show the changes as a patch instead of a diffstat",
+							},
+							&cli.StringFlag{
+								Name:  "color",
+								Usage: "Colorize output: auto, always or never",
+								Value: "auto",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							color, err := useColor(c.String("color"))
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							ctx := &core.Context{}
+							opts := core.StashShowOptions{Patch: c.Bool("patch"), Color: color}
+							if err := ctx.StashShow(c.Args().First(), opts); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:      "update-ref",
+				Usage:     "Point a ref, such as a remote-tracking branch, at an object",
+				ArgsUsage: "<ref> <newvalue> [<oldvalue>] | -d <ref> [<oldvalue>]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "delete",
+						Usage:   "Delete the ref",
+						Aliases: []string{"d"},
+					},
+					&cli.StringFlag{
+						Name:    "message",
+						Usage:   "Reason recorded in the reflog",
+						Aliases: []string{"m"},
+					},
+				},
+				Action: func(c *cli.Context) error {
+					args := c.Args()
+					ctx := &core.Context{}
+					opts := core.UpdateRefOptions{Delete: c.Bool("delete"), Message: c.String("message")}
+					var err error
+					if opts.Delete {
+						if args.Len() < 1 || args.Len() > 2 {
+							return cli.Exit("Usage: drift update-ref -d <ref> [<oldvalue>]", 1)
+						}
+						err = ctx.UpdateRef(args.Get(0), "", args.Get(1), opts)
+					} else {
+						if args.Len() < 2 || args.Len() > 3 {
+							return cli.Exit("Usage: drift update-ref <ref> <newvalue> [<oldvalue>]", 1)
+						}
+						err = ctx.UpdateRef(args.Get(0), args.Get(1), args.Get(2), opts)
+					}
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					return nil
+				},
+			},
 			{
 				Name:  "config",
 				Usage: "Get or set configuration options",
@@ -140,3 +1147,45 @@ func (a *App) Run() error {
 
 	return app.Run(a.args)
 }
+
+func stashPushFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "include-untracked",
+			Aliases: []string{"u"},
+			Usage:   "Also stash untracked files, and remove them",
+		},
+		&cli.StringFlag{
+			Name:    "message",
+			Aliases: []string{"m"},
+			Usage:   "Describe the stash entry",
+		},
+	}
+}
+
+func stashPush(c *cli.Context) error {
+	ctx := &core.Context{}
+	opts := core.StashPushOptions{
+		Message:          c.String("message"),
+		IncludeUntracked: c.Bool("include-untracked"),
+	}
+	if err := ctx.StashPush(opts); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	return nil
+}
+
+// useColor interprets a --color value; "auto" enables color only when
+// stdout is a terminal.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid --color value %q (expected auto, always or never)", mode)
+}
@@ -0,0 +1,319 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type CheckoutOptions struct {
+	Force     bool
+	NewBranch string
+	Detach    bool
+}
+
+func branchExists(repoRoot, name string) bool {
+	hash, err := refs.Read(repoRoot, utils.BranchPrefix+name)
+	return err == nil && hash != ""
+}
+
+// resolveCommit resolves name, peeling annotated tags, and checks that it
+// names a commit.
+func resolveCommit(repoRoot, name string) (string, error) {
+	hash, err := resolveRevision(repoRoot, name)
+	if err != nil {
+		return "", err
+	}
+	hash, _, err = utils.PeelTag(repoRoot, hash)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a valid commit: %v", name, err)
+	}
+	if _, err := utils.ReadCommit(repoRoot, hash); err != nil {
+		return "", fmt.Errorf("%s is not a valid commit: %v", name, err)
+	}
+	return hash, nil
+}
+
+type BranchListOptions struct {
+	// Remotes lists remote-tracking branches instead of local ones.
+	Remotes bool
+	// All lists both.
+	All   bool
+	Color bool
+}
+
+// ListBranches prints local branches, remote-tracking branches with
+// opts.Remotes, or both with opts.All.
+func (c *Context) ListBranches(opts BranchListOptions) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	if !opts.Remotes || opts.All {
+		ref, head, err := utils.ReadHead(repoRoot)
+		if err != nil {
+			return err
+		}
+		current := strings.TrimPrefix(ref, utils.BranchPrefix)
+		if ref == "" {
+			fmt.Printf("* %s\n", colorize(opts.Color, "32", "(HEAD detached at "+head[:7]+")"))
+		}
+
+		branches, err := refs.List(repoRoot, utils.BranchPrefix)
+		if err != nil {
+			return err
+		}
+		for _, name := range branches {
+			if name == current {
+				fmt.Printf("* %s\n", colorize(opts.Color, "32", name))
+			} else {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	}
+
+	if opts.Remotes || opts.All {
+		tracking, err := refs.List(repoRoot, utils.RemotePrefix)
+		if err != nil {
+			return err
+		}
+		for _, name := range tracking {
+			if opts.All {
+				name = "remotes/" + name
+			}
+			fmt.Printf("  %s\n", colorize(opts.Color, "31", name))
+		}
+	}
+	return nil
+}
+
+// CreateBranch creates name pointing at start, or at HEAD when start is "".
+func (c *Context) CreateBranch(name, start string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := utils.CheckRefName(name); err != nil {
+		return err
+	}
+	if branchExists(repoRoot, name) {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+
+	hash, err := resolveCommit(repoRoot, start)
+	if err != nil {
+		return err
+	}
+	if start == "" {
+		start = "HEAD"
+	}
+	return writeRef(repoRoot, utils.BranchPrefix+name, hash, "", "branch: Created from "+start)
+}
+
+// DeleteBranch removes a branch. Unless force is set, the branch must be
+// fully merged into HEAD.
+func (c *Context) DeleteBranch(name string, force bool) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if !branchExists(repoRoot, name) {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+	current, err := utils.CurrentBranch(repoRoot)
+	if err != nil {
+		return err
+	}
+	if current == name {
+		return fmt.Errorf("cannot delete branch '%s' checked out at '%s'", name, repoRoot)
+	}
+
+	hash, err := refs.Read(repoRoot, utils.BranchPrefix+name)
+	if err != nil {
+		return err
+	}
+	if !force {
+		head, err := utils.ResolveHead(repoRoot)
+		if err != nil {
+			return err
+		}
+		merged, err := utils.IsAncestor(repoRoot, hash, head)
+		if err != nil {
+			return err
+		}
+		if !merged {
+			return fmt.Errorf(
+				"the branch '%s' is not fully merged.\n"+
+					"If you are sure you want to delete it, run 'drift branch -D %s'",
+				name, name,
+			)
+		}
+	}
+
+	if err := deleteRef(repoRoot, utils.BranchPrefix+name, hash); err != nil {
+		return err
+	}
+	if err := updateBranchConfig(repoRoot, name, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted branch %s (was %s).\n", name, hash[:7])
+	return nil
+}
+
+// RenameBranch renames oldName to newName, following it with HEAD if it is
+// the current branch.
+func (c *Context) RenameBranch(oldName, newName string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if err := utils.CheckRefName(newName); err != nil {
+		return err
+	}
+	current, err := utils.CurrentBranch(repoRoot)
+	if err != nil {
+		return err
+	}
+	if oldName == "" {
+		if current == "" {
+			return fmt.Errorf("cannot rename the current branch while not on any")
+		}
+		oldName = current
+	}
+	if branchExists(repoRoot, newName) {
+		return fmt.Errorf("a branch named '%s' already exists", newName)
+	}
+
+	hash, err := refs.Read(repoRoot, utils.BranchPrefix+oldName)
+	if err != nil {
+		return err
+	}
+	if hash == "" && oldName != current {
+		return fmt.Errorf("branch '%s' not found", oldName)
+	}
+
+	if hash != "" {
+		oldRef, newRef := utils.BranchPrefix+oldName, utils.BranchPrefix+newName
+		if err := refs.Update(repoRoot, newRef, hash, ""); err != nil {
+			return err
+		}
+		if err := refs.Delete(repoRoot, oldRef, hash); err != nil {
+			return err
+		}
+		if err := utils.RenameReflog(repoRoot, oldRef, newRef); err != nil {
+			return err
+		}
+		msg := fmt.Sprintf("branch: renamed %s to %s", oldRef, newRef)
+		if err := utils.AppendReflog(repoRoot, newRef, hash, hash, msg); err != nil {
+			return err
+		}
+	}
+	if err := updateBranchConfig(repoRoot, oldName, newName); err != nil {
+		return err
+	}
+	if oldName == current {
+		return refs.SetHead(repoRoot, utils.BranchPrefix+newName)
+	}
+	return nil
+}
+
+// Checkout switches to a branch, or detaches HEAD at a commit, and updates
+// the index and working tree to match.
+func (c *Context) Checkout(target string, opts CheckoutOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if opts.NewBranch != "" {
+		if err := c.CreateBranch(opts.NewBranch, target); err != nil {
+			return err
+		}
+		target = opts.NewBranch
+	}
+
+	ref, from, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	fromName, err := headName(repoRoot)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Detach && branchExists(repoRoot, target) {
+		if ref == utils.BranchPrefix+target {
+			fmt.Printf("Already on '%s'\n", target)
+			return nil
+		}
+		to, err := refs.Read(repoRoot, utils.BranchPrefix+target)
+		if err != nil {
+			return err
+		}
+		if err := checkoutTree(repoRoot, from, to, opts.Force); err != nil {
+			return err
+		}
+		if err := moveHead(repoRoot, utils.BranchPrefix+target, "checkout: moving from "+fromName+" to "+target); err != nil {
+			return err
+		}
+		if opts.NewBranch != "" {
+			fmt.Printf("Switched to a new branch '%s'\n", target)
+		} else {
+			fmt.Printf("Switched to branch '%s'\n", target)
+		}
+		return nil
+	}
+
+	to, err := resolveCommit(repoRoot, target)
+	if err != nil {
+		return err
+	}
+	if err := checkoutTree(repoRoot, from, to, opts.Force); err != nil {
+		return err
+	}
+	if err := moveHead(repoRoot, to, "checkout: moving from "+fromName+" to "+target); err != nil {
+		return err
+	}
+
+	commit, err := utils.ReadCommit(repoRoot, to)
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	if ref != "" {
+		fmt.Printf("Note: switching to '%s'.\n\n", target)
+		fmt.Println("You are in 'detached HEAD' state. New commits will not belong to any branch;")
+		fmt.Println("create one with 'drift checkout -b <new-branch>' to keep them.")
+		fmt.Println()
+	}
+	fmt.Printf("HEAD is now at %s %s\n", to[:7], subject)
+	return nil
+}
+
+// Switch is Checkout restricted to branches unless detach is requested.
+func (c *Context) Switch(target string, opts CheckoutOptions) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if !opts.Detach && opts.NewBranch == "" && !branchExists(repoRoot, target) {
+		return fmt.Errorf("invalid reference: %s\n(use --detach to switch to a commit)", target)
+	}
+	return c.Checkout(target, opts)
+}
@@ -1,9 +1,6 @@
 package core
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +8,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/lockfile"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
 	"github.com/sammanbajracharya/drift_cli/internal/utils"
 	"gopkg.in/ini.v1"
 )
@@ -19,9 +20,47 @@ type Context struct{}
 
 type Command interface {
 	InitRepo() error
-	Add(path string) error
-	Status() error
-	Commit(msg string) error
+	Add(path string, force bool) error
+	Status(opts StatusOptions) error
+	Commit(msg string, opts CommitOptions) error
+	Log(opts LogOptions) error
+	LsTree(treeish string, recursive bool) error
+
+	ListBranches(opts BranchListOptions) error
+	CreateBranch(name, start string) error
+	DeleteBranch(name string, force bool) error
+	RenameBranch(oldName, newName string) error
+	Checkout(target string, opts CheckoutOptions) error
+	Switch(target string, opts CheckoutOptions) error
+	Merge(name string) error
+	MergeAbort() error
+	MergeContinue() error
+	Diff(opts DiffOptions) error
+	CheckIgnore(paths []string, verbose bool) (bool, error)
+	GC(opts GCOptions) error
+	Repack() error
+	PackRefs(all bool) error
+	Fsck(opts FsckOptions) (bool, error)
+	Restore(paths []string, opts RestoreOptions) error
+	Rm(paths []string, opts RmOptions) error
+	SetUpstream(branch, upstream string) error
+	UnsetUpstream(branch string) error
+	ListTags(patterns []string) error
+	CreateTag(name, target string, opts TagOptions) error
+	DeleteTag(name string) error
+	Describe(rev string, opts DescribeOptions) error
+	RevParse(args []string, opts RevParseOptions) error
+	ReflogShow(ref string, opts ReflogShowOptions) error
+	ReflogExpire(refs []string, opts ReflogExpireOptions) error
+	MediaList(opts MediaListOptions) error
+	MediaFetch(paths []string) error
+	MediaPrune(opts MediaPruneOptions) error
+	StashPush(opts StashPushOptions) error
+	StashApply(name string, drop bool) error
+	StashDrop(name string) error
+	StashList(opts StashListOptions) error
+	StashShow(name string, opts StashShowOptions) error
+	UpdateRef(ref, newValue, oldValue string, opts UpdateRefOptions) error
 
 	GetConfig(key string) error
 	SetConfig(key, value string) error
@@ -29,9 +68,12 @@ type Command interface {
 	Connect() error
 }
 
-type IndexEntry struct {
-	Hash string
-	Seen bool
+func findRepoRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+	return utils.FindDriftRoot(cwd)
 }
 
 func (c *Context) InitRepo() error {
@@ -99,10 +141,7 @@ func (c *Context) InitRepo() error {
 	return nil
 }
 
-// TODO:
-// add .driftignore feature
-// add garbage collection feature
-func (c *Context) Add(path string) error {
+func (c *Context) Add(path string, force bool) error {
 	if err := utils.CheckInitialized(); err != nil {
 		return err
 	}
@@ -112,225 +151,278 @@ func (c *Context) Add(path string) error {
 		return fmt.Errorf("failed to resolve absolute path: %v", err)
 	}
 
-	info, err := os.Stat(absPath)
-	if err != nil {
-		return fmt.Errorf("file or directory does not exist: %w", err)
-	}
-
 	repoRoot, err := utils.FindDriftRoot(absPath)
 	if err != nil {
 		return fmt.Errorf("failed to find Drift repository root: %v", err)
 	}
-
-	if info.IsDir() {
-		return filepath.WalkDir(absPath, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return nil
-			}
-			if d.IsDir() && d.Name() == ".drift" {
-				return filepath.SkipDir
-			}
-			if d.IsDir() {
-				return nil
-			}
-			return utils.AddFile(path, repoRoot)
-		})
-	} else {
-		return utils.AddFile(absPath, repoRoot)
-	}
-}
-
-func (c *Context) Status() error {
-	if err := utils.CheckInitialized(); err != nil {
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
 		return err
 	}
+	defer lock.Unlock()
 
-	cwd, err := os.Getwd()
+	relPath, err := filepath.Rel(repoRoot, absPath)
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %v", err)
+		return fmt.Errorf("failed to get relative path: %v", err)
 	}
+	prefix := filepath.ToSlash(relPath)
 
-	repoRoot, err := utils.FindDriftRoot(cwd)
+	matcher, err := newIgnoreMatcher(repoRoot)
 	if err != nil {
-		return fmt.Errorf("failed to find Drift repository root: %v", err)
+		return err
 	}
 
-	headFile, err := os.ReadFile(filepath.Join(repoRoot, ".drift", "HEAD"))
-	if err != nil {
-		return fmt.Errorf("failed to read HEAD file: %v", err)
-	}
-	parts := strings.Split(strings.TrimSpace(string(headFile)), "/")
-	branchName := parts[len(parts)-1]
-
-	indexPath := filepath.Join(repoRoot, ".drift", "index")
-	indexMap := map[string]*IndexEntry{}
-	if data, err := os.ReadFile(indexPath); err == nil {
-		lines := bytes.Split(data, []byte("\n"))
-		for _, line := range lines {
-			if len(line) == 0 {
-				continue
-			}
-			parts := bytes.SplitN(line, []byte(" "), 3)
-			if len(parts) < 3 {
-				continue
+	return index.Update(repoRoot, func(idx *index.Index) error {
+		info, err := os.Lstat(absPath)
+		if os.IsNotExist(err) {
+			// Adding a path that is gone stages its removal.
+			removed := removeUnder(idx, prefix, nil)
+			if removed == 0 {
+				return fmt.Errorf("pathspec '%s' did not match any files", path)
 			}
-			indexMap[string(parts[2])] = &IndexEntry{Hash: string(parts[1]), Seen: false}
-		}
-	}
-
-	modifiedFiles := []string{}
-	untrackedFiles := []string{}
-	deletedFiles := []string{}
-
-	err = filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
 			return nil
 		}
-		if d.IsDir() && d.Name() == ".drift" {
-			return filepath.SkipDir
-		}
-		if d.IsDir() {
-			return nil
-		}
-
-		relPath, err := filepath.Rel(repoRoot, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
-		}
-		blob, err := utils.GetBlob(path)
 		if err != nil {
-			return fmt.Errorf("failed to get blob for %s: %v", path, err)
+			return fmt.Errorf("file or directory does not exist: %w", err)
 		}
-		hashBytes := sha256.Sum256(blob)
-		hash := hex.EncodeToString(hashBytes[:])
 
-		if entry, ok := indexMap[relPath]; ok {
-			entry.Seen = true
-			if entry.Hash != hash {
-				modifiedFiles = append(modifiedFiles, relPath)
+		if !info.IsDir() {
+			if _, tracked := idx.Get(prefix); !tracked && !force && matcher.Ignored(prefix, false) {
+				return ignoredPathError(path)
 			}
-		} else {
-			untrackedFiles = append(untrackedFiles, relPath)
+			return utils.AddFile(absPath, repoRoot, idx)
 		}
 
+		tracked := trackedDirs(idx)
+		// A directory named on the command line is refused like a file
+		// would be, rather than silently adding nothing from it.
+		if !force && !tracked[prefix] && matcher.Ignored(prefix, true) {
+			return ignoredPathError(path)
+		}
+		seen := map[string]bool{}
+		err = filepath.WalkDir(absPath, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && d.Name() == ".drift" {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(repoRoot, path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path: %v", err)
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if rel != prefix && !force && !tracked[rel] && matcher.Ignored(rel, true) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, ok := idx.Get(rel); !ok && !force && matcher.Ignored(rel, false) {
+				return nil
+			}
+			seen[rel] = true
+			return utils.AddFile(path, repoRoot, idx)
+		})
+		if err != nil {
+			return err
+		}
+		removeUnder(idx, prefix, seen)
 		return nil
 	})
+}
+
+func ignoredPathError(path string) error {
+	return fmt.Errorf(
+		"The following path is ignored by one of your .driftignore files:\n%s\n"+
+			"Use -f if you really want to add it.",
+		path,
+	)
+}
 
-	for relPath, entry := range indexMap {
-		if !entry.Seen {
-			deletedFiles = append(deletedFiles, relPath)
+// removeUnder drops every entry at or below prefix that is not in keep and
+// returns how many were removed.
+func removeUnder(idx *index.Index, prefix string, keep map[string]bool) int {
+	removed := 0
+	for _, e := range idx.Entries() {
+		if !pathHasPrefix(e.Path, prefix) || keep[e.Path] {
+			continue
 		}
+		idx.Remove(e.Path)
+		removed++
+	}
+	return removed
+}
+
+// pathHasPrefix reports whether the slash-separated path p is dir itself or
+// lies below it. The repository root is written as ".".
+func pathHasPrefix(p, dir string) bool {
+	if dir == "." || dir == "" {
+		return true
 	}
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
 
-	fmt.Printf("On branch %s\n", branchName)
-	fmt.Println("Your branch is up to date with 'origin/" + branchName + "'.")
-	fmt.Println()
+type CommitOptions struct {
+	Author string
+	Date   string
+	// All stages modified and deleted tracked files before committing.
+	All bool
+}
 
-	if len(modifiedFiles) > 0 {
-		fmt.Println("Changes not staged for commit:")
-		fmt.Println(`  (use "drift add <file>..." to update what will be committed)`)
-		fmt.Println(`  (use "drift restore <file>..." to discard changes in working directory)`)
-		for _, file := range modifiedFiles {
-			fmt.Printf("        \033[34mmodified:   %s\033[0m\n", file)
-		}
-		fmt.Println()
+func (c *Context) Commit(msg string, opts CommitOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
 	}
 
-	if len(untrackedFiles) > 0 {
-		fmt.Println("Untracked files:")
-		fmt.Println(`  (use "drift add <file>..." to include in what will be committed)`)
-		for _, file := range untrackedFiles {
-			fmt.Printf("        \033[31m%s\033[0m\n", file)
-		}
-		fmt.Println()
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
 	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
-	if len(deletedFiles) > 0 {
-		fmt.Println("Deleted files:")
-		fmt.Println(`  (use "drift restore <file>..." to restore or "drift rm" to remove)`)
-		for _, file := range deletedFiles {
-			fmt.Printf("        \033[31mdeleted:   %s\033[0m\n", file)
+	if opts.All {
+		if err := stageTracked(repoRoot); err != nil {
+			return err
 		}
-		fmt.Println()
 	}
 
-	if len(modifiedFiles) == 0 && len(untrackedFiles) == 0 {
-		fmt.Println("nothing to commit, working tree clean")
-	} else {
-		fmt.Println("no changes added to commit (use \"drift add\" and/or \"drift commit -a\")")
+	// The index lock keeps add from changing what is being committed.
+	idxLock, err := lockfile.Acquire(index.Path(repoRoot))
+	if err != nil {
+		return fmt.Errorf("cannot commit: %v", err)
 	}
-
-	return nil
-}
-
-func (c *Context) Commit(msg string) error {
-	if err := utils.CheckInitialized(); err != nil {
+	defer idxLock.Rollback()
+	idx, err := index.Read(repoRoot)
+	if err != nil {
 		return err
 	}
-
-	indexPath := filepath.Join(".drift", "index")
-	existingIndex, err := os.ReadFile(indexPath)
+	merge, err := readMergeState(repoRoot)
 	if err != nil {
-		return fmt.Errorf("Error reading index file: %v", err)
+		return err
+	}
+	parent, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
 	}
-	if len(existingIndex) == 0 {
+	// An empty index is only nothing to commit on an unborn branch; on top
+	// of a commit it records the removal of the last tracked files.
+	if idx.Len() == 0 && parent == "" && merge == nil {
 		return fmt.Errorf("nothing to commit")
 	}
 
-	entries, err := utils.ParseIndex(existingIndex)
+	treeHash, err := utils.BuildTree(utils.IndexTreeEntries(idx), repoRoot)
 	if err != nil {
-		return fmt.Errorf("failed to write tree: %v", err)
+		return fmt.Errorf("failed to build tree: %v", err)
 	}
 
-	repoRoot, err := utils.FindDriftRoot(indexPath)
+	parents := []string{}
+	if parent != "" {
+		parents = append(parents, parent)
+	}
+	if merge != nil {
+		unresolved, err := unresolvedConflicts(repoRoot, idx, merge.Conflicts)
+		if err != nil {
+			return err
+		}
+		if len(unresolved) > 0 {
+			return fmt.Errorf(
+				"cannot commit because of unresolved conflicts:\n\t%s\n"+
+					"Fix them, 'drift add' the results and try again",
+				strings.Join(unresolved, "\n\t"),
+			)
+		}
+		parents = append(parents, merge.Head)
+	} else if parent != "" {
+		parentCommit, err := utils.ReadCommit(repoRoot, parent)
+		if err != nil {
+			return err
+		}
+		if parentCommit.Tree == treeHash {
+			return fmt.Errorf("nothing to commit, working tree clean")
+		}
+	}
 
-	treeHash, err := utils.BuildTree(entries, repoRoot)
+	committer, err := utils.ResolveIdentity(repoRoot, utils.RoleCommitter)
 	if err != nil {
-		return fmt.Errorf("failed to build tree: %v", err)
+		return err
+	}
+	author, err := utils.ResolveIdentity(repoRoot, utils.RoleAuthor)
+	if err != nil && opts.Author == "" {
+		return err
+	}
+	if opts.Author != "" {
+		override, err := utils.ParseIdent(opts.Author)
+		if err != nil {
+			return err
+		}
+		author.Name, author.Email = override.Name, override.Email
+		if author.When.IsZero() {
+			author.When = time.Now()
+		}
+	}
+	if opts.Date != "" {
+		when, err := utils.ParseDate(opts.Date)
+		if err != nil {
+			return fmt.Errorf("invalid --date: %v", err)
+		}
+		author.When = when
 	}
 
-	author := "YourName <you@example.com>"
-	timestamp := time.Now().Unix()
-	commitContent := fmt.Sprintf(
-		"tree %s\nauthor %s %d +0000\ncommitter %s %d +0000\n\n%s\n",
-		treeHash,
-		author,
-		timestamp,
-		author,
-		timestamp,
-		msg,
-	)
+	var commitContent strings.Builder
+	fmt.Fprintf(&commitContent, "tree %s\n", treeHash)
+	for _, p := range parents {
+		fmt.Fprintf(&commitContent, "parent %s\n", p)
+	}
+	fmt.Fprintf(&commitContent, "author %s\n", author)
+	fmt.Fprintf(&commitContent, "committer %s\n", committer)
+	fmt.Fprintf(&commitContent, "\n%s\n", msg)
 
-	commitHash, err := utils.WriteObject(repoRoot, "commit", []byte(commitContent))
+	commitHash, err := objects.NewStore(repoRoot).Put("commit", []byte(commitContent.String()))
 	if err != nil {
 		return fmt.Errorf("failed to write commit object: %v", err)
 	}
 
-	headPath := filepath.Join(repoRoot, ".drift", "HEAD")
-	headData, err := os.ReadFile(headPath)
-	if err != nil {
-		return fmt.Errorf("failed to read HEAD file: %v", err)
+	reason := "commit"
+	switch {
+	case merge != nil:
+		reason = "commit (merge)"
+	case parent == "":
+		reason = "commit (initial)"
 	}
-
-	if bytes.HasPrefix(headData, []byte("ref: ")) {
-		branchRef := strings.TrimSpace(strings.TrimPrefix(string(headData), "ref: "))
-		if err := os.WriteFile(filepath.Join(repoRoot, ".drift/", branchRef), []byte(commitHash), 0644); err != nil {
-			return fmt.Errorf("failed to update branch ref: %v", err)
-		}
-	} else {
-		if err := os.WriteFile(headPath, []byte(commitHash), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %v", err)
-		}
+	subject, _, _ := strings.Cut(msg, "\n")
+	if err := updateHead(repoRoot, commitHash, parent, reason+": "+subject); err != nil {
+		return err
 	}
-
-	if err := os.WriteFile(indexPath, []byte{}, 0644); err != nil {
-		return fmt.Errorf("failed to clear index: %v", err)
+	if merge != nil {
+		clearMergeState(repoRoot)
 	}
 
 	fmt.Printf("Commited as %s\n", commitHash)
 	return nil
 }
 
+// updateHead moves the checked out branch, or HEAD itself when detached,
+// from old to commitHash, logging reason in the reflogs. It fails if
+// another process moved it away from old in the meantime.
+func updateHead(repoRoot, commitHash, old, reason string) error {
+	ref, _, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		return writeRef(repoRoot, ref, commitHash, old, reason)
+	}
+	if err := refs.Update(repoRoot, "HEAD", commitHash, old); err != nil {
+		return err
+	}
+	return utils.AppendReflog(repoRoot, "HEAD", old, commitHash, reason)
+}
+
 func (c *Context) InitConfig() error {
 	homeDir, _ := os.UserHomeDir()
 	driftHome := filepath.Join(homeDir, ".drift")
@@ -380,15 +472,15 @@ func (c *Context) GetConfig(key string, useGlobal bool) (string, error) {
 		return "", err
 	}
 
-	section := cfg.Section("user")
-	return section.Key(key).String(), nil
+	section, name := splitConfigKey(key)
+	return cfg.Section(section).Key(name).String(), nil
 }
 
 func (c *Context) SetConfig(key, value string, useGlobal bool) error {
 	var configPath string
 	if useGlobal {
 		homeDir, _ := os.UserHomeDir()
-		configPath := filepath.Join(homeDir, ".drift", "config")
+		configPath = filepath.Join(homeDir, ".drift", "config")
 		os.MkdirAll(filepath.Dir(configPath), 0755)
 	} else {
 		if err := utils.CheckInitialized(); err != nil {
@@ -402,7 +494,8 @@ func (c *Context) SetConfig(key, value string, useGlobal bool) error {
 		return err
 	}
 
-	cfg.Section("user").Key(key).SetValue(value)
+	section, name := splitConfigKey(key)
+	cfg.Section(section).Key(name).SetValue(value)
 	err = cfg.SaveTo(configPath)
 	if err != nil {
 		return fmt.Errorf("error saving config: %v", err)
@@ -411,6 +504,15 @@ func (c *Context) SetConfig(key, value string, useGlobal bool) error {
 	return nil
 }
 
+// splitConfigKey maps "section.key" to its section and key. Bare keys
+// belong to the [user] section.
+func splitConfigKey(key string) (string, string) {
+	if section, name, ok := strings.Cut(key, "."); ok {
+		return section, name
+	}
+	return "user", key
+}
+
 func (c *Context) Connect() error {
 	return nil
 }
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+func TestCommitRemovalOfLastFile(t *testing.T) {
+	c, repoRoot := initTestRepo(t)
+	if err := c.Commit("empty", CommitOptions{}); err == nil {
+		t.Fatal("committing an empty index on an unborn branch succeeded")
+	}
+
+	if err := os.WriteFile("a", []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add("a", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Commit("add a", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Rm([]string{"a"}, RmOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Commit("remove a", CommitOptions{}); err != nil {
+		t.Fatalf("committing the removal of the last file: %v", err)
+	}
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := utils.ReadCommit(repoRoot, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit.Parents) != 1 || commit.Parents[0] != first {
+		t.Fatalf("parents = %v, want [%s]", commit.Parents, first)
+	}
+	files, err := commitFiles(repoRoot, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("HEAD tree holds %v, want nothing", files)
+	}
+
+	if err := c.Commit("again", CommitOptions{}); err == nil {
+		t.Fatal("committing an unchanged empty tree succeeded")
+	}
+}
+
+func TestAddIgnoredDirectory(t *testing.T) {
+	c, repoRoot := initTestRepo(t)
+	if err := os.WriteFile(".driftignore", []byte("build/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("build/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("build/sub/out", []byte("out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"build", "build/sub"} {
+		err := c.Add(path, false)
+		if err == nil || !strings.Contains(err.Error(), "Use -f") {
+			t.Fatalf("adding ignored directory %s: err = %v, want a hint to use -f", path, err)
+		}
+	}
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(idx.Entries()); n != 0 {
+		t.Fatalf("index has %d entries after refused adds, want 0", n)
+	}
+
+	if err := c.Add("build", true); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = index.Read(repoRoot); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Get("build/sub/out"); !ok {
+		t.Fatal("forced add did not stage build/sub/out")
+	}
+	// Once something below it is tracked, the directory can be re-added.
+	if err := c.Add("build", false); err != nil {
+		t.Fatalf("re-adding a tracked ignored directory: %v", err)
+	}
+}
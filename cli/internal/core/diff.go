@@ -0,0 +1,402 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/diff"
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+const diffContext = 3
+
+type DiffOptions struct {
+	Staged   bool
+	Stat     bool
+	NameOnly bool
+	Color    bool
+	// Revs holds zero, one or two commits. With none the working tree is
+	// compared against the index (or the index against HEAD when Staged),
+	// with one the working tree against that commit, with two the first
+	// commit against the second. A single A..B or A...B range counts as
+	// two.
+	Revs []string
+}
+
+// diffSide is one side of a comparison: a set of files and a way to load
+// their content.
+type diffSide struct {
+	label    string
+	files    map[string]utils.TreeEntry
+	worktree bool
+}
+
+type fileChange struct {
+	path     string
+	old      utils.TreeEntry
+	new      utils.TreeEntry
+	hasOld   bool
+	hasNew   bool
+	oldBytes []byte
+	newBytes []byte
+}
+
+func indexFiles(idx *index.Index) map[string]utils.TreeEntry {
+	files := map[string]utils.TreeEntry{}
+	for _, e := range idx.Entries() {
+		files[e.Path] = utils.TreeEntry{Mode: e.Mode, Type: "blob", Hash: e.Hash, Name: e.Path}
+	}
+	return files
+}
+
+// worktreeFiles hashes the working copies of paths, skipping those that no
+// longer exist.
+func worktreeFiles(repoRoot string, idx *index.Index, paths map[string]utils.TreeEntry) (map[string]utils.TreeEntry, error) {
+	list := make([]string, 0, len(paths))
+	for p := range paths {
+		list = append(list, p)
+	}
+	files, refresh, err := worktreeHashes(repoRoot, idx, list)
+	if err != nil {
+		return nil, err
+	}
+	refreshIndex(repoRoot, refresh)
+	return files, nil
+}
+
+func (c *Context) Diff(opts DiffOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	oldSide, newSide, err := diffSides(repoRoot, opts)
+	if err != nil {
+		return err
+	}
+	changes, err := collectChanges(repoRoot, oldSide, newSide)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.NameOnly:
+		for _, ch := range changes {
+			fmt.Println(ch.path)
+		}
+	case opts.Stat:
+		printDiffStat(changes, opts.Color)
+	default:
+		for _, ch := range changes {
+			printFileDiff(ch, opts.Color)
+		}
+	}
+	return nil
+}
+
+func diffSides(repoRoot string, opts DiffOptions) (diffSide, diffSide, error) {
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		return diffSide{}, diffSide{}, err
+	}
+	staged := indexFiles(idx)
+
+	treeSide := func(rev string) (diffSide, error) {
+		hash, err := resolveCommit(repoRoot, rev)
+		if err != nil {
+			return diffSide{}, err
+		}
+		files, err := commitFiles(repoRoot, hash)
+		return diffSide{label: rev, files: files}, err
+	}
+
+	// A single range compares its two ends; A...B shows what B changed
+	// since it forked from A.
+	if len(opts.Revs) == 1 && strings.Contains(opts.Revs[0], "..") {
+		if opts.Revs, err = rangeEnds(repoRoot, opts.Revs[0]); err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+	}
+
+	switch len(opts.Revs) {
+	case 0:
+		if opts.Staged {
+			head, err := utils.ResolveHead(repoRoot)
+			if err != nil {
+				return diffSide{}, diffSide{}, err
+			}
+			files, err := commitFiles(repoRoot, head)
+			if err != nil {
+				return diffSide{}, diffSide{}, err
+			}
+			return diffSide{label: "HEAD", files: files}, diffSide{label: "index", files: staged}, nil
+		}
+		work, err := worktreeFiles(repoRoot, idx, staged)
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		return diffSide{label: "index", files: staged}, diffSide{label: "worktree", files: work, worktree: true}, nil
+
+	case 1:
+		oldSide, err := treeSide(opts.Revs[0])
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		if opts.Staged {
+			return oldSide, diffSide{label: "index", files: staged}, nil
+		}
+		tracked := map[string]utils.TreeEntry{}
+		for p, e := range oldSide.files {
+			tracked[p] = e
+		}
+		for p, e := range staged {
+			tracked[p] = e
+		}
+		work, err := worktreeFiles(repoRoot, idx, tracked)
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		return oldSide, diffSide{label: "worktree", files: work, worktree: true}, nil
+
+	case 2:
+		oldSide, err := treeSide(opts.Revs[0])
+		if err != nil {
+			return diffSide{}, diffSide{}, err
+		}
+		newSide, err := treeSide(opts.Revs[1])
+		return oldSide, newSide, err
+	}
+	return diffSide{}, diffSide{}, fmt.Errorf("too many revisions given to diff")
+}
+
+func collectChanges(repoRoot string, oldSide, newSide diffSide) ([]fileChange, error) {
+	store := objects.NewStore(repoRoot)
+	load := func(side diffSide, e utils.TreeEntry) ([]byte, error) {
+		if side.worktree && e.Mode == index.ModeSymlink {
+			target, err := os.Readlink(filepath.Join(repoRoot, filepath.FromSlash(e.Name)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read symlink %s: %v", e.Name, err)
+			}
+			return []byte(target), nil
+		}
+		if side.worktree {
+			// Media files are compared as the pointers they would be
+			// stored as, not read whole.
+			full := filepath.Join(repoRoot, filepath.FromSlash(e.Name))
+			if info, err := os.Lstat(full); err == nil {
+				if p, ok, err := worktreePointer(repoRoot, e.Name, info); err != nil {
+					return nil, err
+				} else if ok {
+					return p.Bytes(), nil
+				}
+			}
+			data, err := os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(e.Name)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", e.Name, err)
+			}
+			return data, nil
+		}
+		return readBlob(store, e.Hash)
+	}
+
+	paths := []string{}
+	for p := range oldSide.files {
+		paths = append(paths, p)
+	}
+	for p := range newSide.files {
+		if _, ok := oldSide.files[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []fileChange{}
+	for _, p := range paths {
+		o, hasOld := oldSide.files[p]
+		n, hasNew := newSide.files[p]
+		if sameEntry(o, n, hasOld, hasNew) {
+			continue
+		}
+		ch := fileChange{path: p, old: o, new: n, hasOld: hasOld, hasNew: hasNew}
+		var err error
+		if hasOld {
+			o.Name = p
+			if ch.oldBytes, err = load(oldSide, o); err != nil {
+				return nil, err
+			}
+		}
+		if hasNew {
+			n.Name = p
+			if ch.newBytes, err = load(newSide, n); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, ch)
+	}
+	return changes, nil
+}
+
+func colorize(on bool, code, s string) string {
+	if !on {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+func shortHash(h string) string {
+	if len(h) < 7 {
+		return "0000000"
+	}
+	return h[:7]
+}
+
+func printFileDiff(ch fileChange, color bool) {
+	meta := func(s string) { fmt.Println(colorize(color, "1", s)) }
+
+	meta(fmt.Sprintf("diff --drift a/%s b/%s", ch.path, ch.path))
+	switch {
+	case !ch.hasOld:
+		meta("new file mode " + ch.new.Mode)
+	case !ch.hasNew:
+		meta("deleted file mode " + ch.old.Mode)
+	case ch.old.Mode != ch.new.Mode:
+		meta("old mode " + ch.old.Mode)
+		meta("new mode " + ch.new.Mode)
+	}
+	oldHash, newHash := "", ""
+	if ch.hasOld {
+		oldHash = ch.old.Hash
+	}
+	if ch.hasNew {
+		newHash = ch.new.Hash
+	}
+	if oldHash != newHash {
+		meta(fmt.Sprintf("index %s..%s", shortHash(oldHash), shortHash(newHash)))
+	}
+
+	oldName, newName := "a/"+ch.path, "b/"+ch.path
+	if !ch.hasOld {
+		oldName = "/dev/null"
+	}
+	if !ch.hasNew {
+		newName = "/dev/null"
+	}
+
+	if diff.IsBinary(ch.oldBytes) || diff.IsBinary(ch.newBytes) {
+		if oldHash != newHash {
+			fmt.Printf("Binary files %s and %s differ\n", oldName, newName)
+		}
+		return
+	}
+	if oldHash == newHash {
+		return
+	}
+
+	meta("--- " + oldName)
+	meta("+++ " + newName)
+
+	hunks := diff.Hunks(diff.SplitLines(string(ch.oldBytes)), diff.SplitLines(string(ch.newBytes)), diffContext)
+	for _, h := range hunks {
+		fmt.Println(colorize(color, "36", fmt.Sprintf(
+			"@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines),
+		)))
+		for _, l := range h.Lines {
+			prefix, code := " ", ""
+			switch l.Op {
+			case diff.Delete:
+				prefix, code = "-", "31"
+			case diff.Insert:
+				prefix, code = "+", "32"
+			}
+			text := strings.TrimSuffix(l.Text, "\n")
+			if code != "" {
+				fmt.Println(colorize(color, code, prefix+text))
+			} else {
+				fmt.Println(prefix + text)
+			}
+			if !strings.HasSuffix(l.Text, "\n") {
+				fmt.Println(`\ No newline at end of file`)
+			}
+		}
+	}
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+func printDiffStat(changes []fileChange, color bool) {
+	const barWidth = 50
+
+	type stat struct {
+		path       string
+		ins, del   int
+		binary     bool
+		oldN, newN int
+	}
+	stats := []stat{}
+	nameWidth, maxChange := 0, 0
+	totalIns, totalDel := 0, 0
+	for _, ch := range changes {
+		s := stat{path: ch.path}
+		if diff.IsBinary(ch.oldBytes) || diff.IsBinary(ch.newBytes) {
+			s.binary = true
+			s.oldN, s.newN = len(ch.oldBytes), len(ch.newBytes)
+		} else {
+			s.ins, s.del = diff.Stat(diff.SplitLines(string(ch.oldBytes)), diff.SplitLines(string(ch.newBytes)))
+		}
+		totalIns += s.ins
+		totalDel += s.del
+		if len(s.path) > nameWidth {
+			nameWidth = len(s.path)
+		}
+		if s.ins+s.del > maxChange {
+			maxChange = s.ins + s.del
+		}
+		stats = append(stats, s)
+	}
+
+	for _, s := range stats {
+		if s.binary {
+			fmt.Printf(" %-*s | Bin %d -> %d bytes\n", nameWidth, s.path, s.oldN, s.newN)
+			continue
+		}
+		ins, del := s.ins, s.del
+		if maxChange > barWidth {
+			ins = (ins*barWidth + maxChange - 1) / maxChange
+			del = (del*barWidth + maxChange - 1) / maxChange
+		}
+		fmt.Printf(" %-*s | %d %s%s\n", nameWidth, s.path, s.ins+s.del,
+			colorize(color, "32", strings.Repeat("+", ins)),
+			colorize(color, "31", strings.Repeat("-", del)),
+		)
+	}
+
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	summary := " " + plural(len(stats), "file") + " changed"
+	if totalIns > 0 {
+		summary += fmt.Sprintf(", %s(+)", plural(totalIns, "insertion"))
+	}
+	if totalDel > 0 {
+		summary += fmt.Sprintf(", %s(-)", plural(totalDel, "deletion"))
+	}
+	if len(stats) > 0 {
+		fmt.Println(summary)
+	}
+}
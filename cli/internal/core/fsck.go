@@ -0,0 +1,392 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type FsckOptions struct {
+	JSON bool
+	// NoDangling hides objects that nothing refers to.
+	NoDangling bool
+	Color      bool
+}
+
+// Problem kinds reported by fsck. Only dangling objects and stray files
+// are harmless; everything else means the repository is damaged.
+const (
+	fsckCorrupt  = "corrupt"
+	fsckMissing  = "missing"
+	fsckBadLink  = "bad-link"
+	fsckBadRef   = "bad-ref"
+	fsckBadIndex = "bad-index"
+	fsckDangling = "dangling"
+	fsckStray    = "stray"
+)
+
+type fsckProblem struct {
+	Kind    string `json:"kind"`
+	Object  string `json:"object,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p fsckProblem) fatal() bool {
+	return p.Kind != fsckDangling && p.Kind != fsckStray
+}
+
+type fsckReport struct {
+	OK       bool          `json:"ok"`
+	Loose    int           `json:"loose"`
+	Packed   int           `json:"packed"`
+	Problems []fsckProblem `json:"problems"`
+}
+
+type fsckChecker struct {
+	repoRoot string
+	store    *objects.Store
+	types    map[string]string
+	links    map[string][]fsckLink
+	report   fsckReport
+}
+
+// fsckLink is a reference from one object to another, with the type the
+// referring object expects it to have.
+type fsckLink struct {
+	id   string
+	want string
+}
+
+func (f *fsckChecker) add(p fsckProblem) {
+	f.report.Problems = append(f.report.Problems, p)
+}
+
+var validTreeModes = map[string]string{
+	"100644": "blob",
+	"100755": "blob",
+	"120000": "blob",
+	"040000": "tree",
+}
+
+// verifyObject reads r to the end so the object reader checks the size
+// and hash, then validates the structure of commits, trees and tags.
+func (f *fsckChecker) verifyObject(id string, r *objects.Reader, where string) {
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Path: where, Message: err.Error()})
+		return
+	}
+	if prev, ok := f.types[id]; ok {
+		if prev != r.Type {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Message: fmt.Sprintf("stored as both %s and %s", prev, r.Type)})
+		}
+		return
+	}
+
+	switch r.Type {
+	case "blob":
+		for _, chunk := range r.Chunks() {
+			f.links[id] = append(f.links[id], fsckLink{chunk, objects.ChunkType})
+		}
+	case objects.ChunkType:
+	case "commit":
+		commit, err := utils.ParseCommit(id, data)
+		if err != nil {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: err.Error()})
+			return
+		}
+		if commit.Author.Name == "" || commit.Committer.Name == "" {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: "missing author or committer"})
+		}
+		links := []fsckLink{{commit.Tree, "tree"}}
+		for _, p := range commit.Parents {
+			links = append(links, fsckLink{p, "commit"})
+		}
+		f.links[id] = links
+	case "tree":
+		entries, err := utils.ParseTree(data)
+		if err != nil {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: err.Error()})
+			return
+		}
+		links := make([]fsckLink, 0, len(entries))
+		prevName := ""
+		for i, e := range entries {
+			if want, ok := validTreeModes[e.Mode]; !ok || want != e.Type {
+				f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: fmt.Sprintf("entry %q has bad mode %s %s", e.Name, e.Mode, e.Type)})
+			}
+			if !utils.ValidTreeName(e.Name) {
+				f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: fmt.Sprintf("entry has invalid name %q", e.Name)})
+			}
+			if i > 0 && e.Name <= prevName {
+				f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: fmt.Sprintf("entries not sorted or duplicated at %q", e.Name)})
+			}
+			prevName = e.Name
+			links = append(links, fsckLink{e.Hash, e.Type})
+		}
+		f.links[id] = links
+	case "tag":
+		tag, err := utils.ParseTag(id, data)
+		if err != nil {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: err.Error()})
+			return
+		}
+		if tag.Tagger.Name == "" {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: "missing tagger"})
+		}
+		f.links[id] = []fsckLink{{tag.Object, tag.Type}}
+	default:
+		f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Type: r.Type, Message: fmt.Sprintf("unknown object type %q", r.Type)})
+		return
+	}
+	f.types[id] = r.Type
+}
+
+func (f *fsckChecker) checkObjects() error {
+	loose, garbage, err := f.store.Loose()
+	if err != nil {
+		return err
+	}
+	for _, obj := range loose {
+		f.report.Loose++
+		r, err := f.store.Open(obj.Hash)
+		if err != nil {
+			f.add(fsckProblem{Kind: fsckCorrupt, Object: obj.Hash, Path: obj.Path, Message: err.Error()})
+			continue
+		}
+		f.verifyObject(obj.Hash, r, obj.Path)
+	}
+	for _, obj := range garbage {
+		f.add(fsckProblem{Kind: fsckStray, Path: obj.Path, Message: "not an object (interrupted write?); drift gc removes it"})
+	}
+
+	packs, err := f.store.Packs()
+	if errors.Is(err, objects.ErrCorrupt) {
+		f.add(fsckProblem{Kind: fsckCorrupt, Message: err.Error()})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range packs {
+		if err := p.Verify(); err != nil {
+			f.add(fsckProblem{Kind: fsckCorrupt, Path: p.Path(), Message: err.Error()})
+		}
+		for _, id := range p.IDs() {
+			f.report.Packed++
+			r, err := f.store.OpenPacked(id)
+			if err != nil {
+				f.add(fsckProblem{Kind: fsckCorrupt, Object: id, Path: p.Path(), Message: err.Error()})
+				continue
+			}
+			f.verifyObject(id, r, p.Path())
+		}
+	}
+	stray, err := f.store.StrayPackFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range stray {
+		f.add(fsckProblem{Kind: fsckStray, Path: path, Message: "not part of a complete pack"})
+	}
+	return nil
+}
+
+// checkLinks verifies that every object a commit, tree or tag refers to
+// exists and has the expected type.
+func (f *fsckChecker) checkLinks() {
+	ids := make([]string, 0, len(f.links))
+	for id := range f.links {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		objType := f.types[id]
+		for _, link := range f.links[id] {
+			got, ok := f.types[link.id]
+			if !ok {
+				f.add(fsckProblem{Kind: fsckMissing, Object: link.id, Type: link.want, Message: fmt.Sprintf("referenced by %s %s", objType, id)})
+				continue
+			}
+			if got != link.want {
+				f.add(fsckProblem{Kind: fsckBadLink, Object: id, Type: objType, Message: fmt.Sprintf("refers to %s as a %s, but it is a %s", link.id, link.want, got)})
+			}
+		}
+	}
+}
+
+// checkRoots verifies refs, HEAD and the index, and returns every id they
+// name.
+func (f *fsckChecker) checkRoots() ([]string, error) {
+	roots := []string{}
+
+	headData, err := os.ReadFile(driftFile(f.repoRoot, "HEAD"))
+	if err != nil {
+		f.add(fsckProblem{Kind: fsckBadRef, Path: "HEAD", Message: "HEAD is missing"})
+	} else if head := strings.TrimSpace(string(headData)); strings.HasPrefix(head, "ref: ") {
+		if target := strings.TrimPrefix(head, "ref: "); !strings.HasPrefix(target, "refs/") {
+			f.add(fsckProblem{Kind: fsckBadRef, Path: "HEAD", Message: fmt.Sprintf("HEAD points outside refs/: %q", target)})
+		}
+	} else if !fullHashRe.MatchString(head) {
+		f.add(fsckProblem{Kind: fsckBadRef, Path: "HEAD", Message: fmt.Sprintf("detached HEAD is not an object id: %q", head)})
+	}
+
+	refs, err := refRoots(f.repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash := refs[name]
+		switch objType, ok := f.types[hash]; {
+		case !fullHashRe.MatchString(hash):
+			f.add(fsckProblem{Kind: fsckBadRef, Path: name, Message: fmt.Sprintf("%s does not contain an object id: %q", name, hash)})
+		case !ok:
+			f.add(fsckProblem{Kind: fsckBadRef, Object: hash, Path: name, Message: fmt.Sprintf("%s points to a missing or corrupt object", name)})
+		case objType == "tag" && strings.HasPrefix(name, utils.TagPrefix):
+			roots = append(roots, hash)
+		case objType != "commit":
+			f.add(fsckProblem{Kind: fsckBadRef, Object: hash, Path: name, Message: fmt.Sprintf("%s points to a %s, not a commit", name, objType)})
+		default:
+			roots = append(roots, hash)
+		}
+	}
+
+	logged, err := reflogRoots(f.repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	roots = append(roots, logged...)
+
+	idx, err := index.Read(f.repoRoot)
+	if err != nil {
+		f.add(fsckProblem{Kind: fsckBadIndex, Message: err.Error()})
+		return roots, nil
+	}
+	for _, e := range idx.Entries() {
+		if objType, ok := f.types[e.Hash]; !ok {
+			f.add(fsckProblem{Kind: fsckBadIndex, Object: e.Hash, Path: e.Path, Message: fmt.Sprintf("index entry %s points to a missing object", e.Path)})
+		} else if objType != "blob" {
+			f.add(fsckProblem{Kind: fsckBadIndex, Object: e.Hash, Path: e.Path, Message: fmt.Sprintf("index entry %s points to a %s", e.Path, objType)})
+		} else {
+			roots = append(roots, e.Hash)
+		}
+	}
+	return roots, nil
+}
+
+// checkDangling reports unreachable objects that no other unreachable
+// object refers to, i.e. the tips of whatever history was abandoned.
+func (f *fsckChecker) checkDangling(roots []string) {
+	reachable := map[string]bool{}
+	stack := roots
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[id] {
+			continue
+		}
+		reachable[id] = true
+		for _, link := range f.links[id] {
+			stack = append(stack, link.id)
+		}
+	}
+
+	referenced := map[string]bool{}
+	for _, links := range f.links {
+		for _, link := range links {
+			referenced[link.id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(f.types))
+	for id := range f.types {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !reachable[id] && !referenced[id] {
+			f.add(fsckProblem{Kind: fsckDangling, Object: id, Type: f.types[id], Message: fmt.Sprintf("dangling %s", f.types[id])})
+		}
+	}
+}
+
+// Fsck verifies the object store and refs. It returns false when the
+// repository is damaged.
+func (c *Context) Fsck(opts FsckOptions) (bool, error) {
+	if err := utils.CheckInitialized(); err != nil {
+		return false, err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return false, err
+	}
+
+	f := &fsckChecker{
+		repoRoot: repoRoot,
+		store:    objects.NewStore(repoRoot),
+		types:    map[string]string{},
+		links:    map[string][]fsckLink{},
+		report:   fsckReport{Problems: []fsckProblem{}},
+	}
+	if err := f.checkObjects(); err != nil {
+		return false, err
+	}
+	f.checkLinks()
+	roots, err := f.checkRoots()
+	if err != nil {
+		return false, err
+	}
+	if !opts.NoDangling {
+		f.checkDangling(roots)
+	}
+
+	f.report.OK = true
+	for _, p := range f.report.Problems {
+		if p.fatal() {
+			f.report.OK = false
+		}
+	}
+
+	if opts.JSON {
+		out, err := json.MarshalIndent(f.report, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println(string(out))
+		return f.report.OK, nil
+	}
+
+	for _, p := range f.report.Problems {
+		switch {
+		case p.Kind == fsckDangling:
+			fmt.Printf("dangling %s %s\n", p.Type, p.Object)
+		case p.Kind == fsckStray:
+			fmt.Printf("warning: %s: %s\n", p.Path, p.Message)
+		case p.Kind == fsckMissing:
+			fmt.Printf("%s (%s)\n", colorize(opts.Color, "31", "missing "+p.Type+" "+p.Object), p.Message)
+		case p.Object != "" && p.Type != "":
+			fmt.Println(colorize(opts.Color, "31", fmt.Sprintf("error in %s %s: %s", p.Type, p.Object, p.Message)))
+		default:
+			fmt.Println(colorize(opts.Color, "31", "error: "+p.Message))
+		}
+	}
+	fmt.Printf("Checked %d loose and %d packed objects\n", f.report.Loose, f.report.Packed)
+	return f.report.OK, nil
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/lockfile"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type GCOptions struct {
+	DryRun bool
+	// PruneBefore keeps unreachable objects modified after this time. The
+	// repository lock already keeps out drift commands that are writing
+	// objects; the grace period also covers platforms without the lock and
+	// objects that arrive by other means.
+	PruneBefore time.Time
+}
+
+func repoLockPath(repoRoot string) string {
+	return filepath.Join(repoRoot, ".drift", "repo.lock")
+}
+
+// lockRepo takes the repository lock shared, for a command that writes
+// objects or moves refs. It waits while gc or repack is running.
+func lockRepo(repoRoot string) (*lockfile.RepoLock, error) {
+	return lockfile.LockRepo(repoLockPath(repoRoot), false)
+}
+
+// lockRepoExclusive takes the repository lock for a command that deletes
+// objects, failing if any other drift command is writing.
+func lockRepoExclusive(repoRoot string) (*lockfile.RepoLock, error) {
+	return lockfile.LockRepo(repoLockPath(repoRoot), true)
+}
+
+func (c *Context) GC(opts GCOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	// Every command that writes objects or moves refs holds the repository
+	// lock shared from its first object to its last ref update, so with it
+	// held exclusively no new root can appear while the object graph is
+	// marked and pruned.
+	lock, err := lockRepoExclusive(repoRoot)
+	if err != nil {
+		return fmt.Errorf("cannot run gc: %v", err)
+	}
+	defer lock.Unlock()
+
+	reachable, missing, err := reachableObjects(repoRoot)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+	loose, garbage, err := store.Loose()
+	if err != nil {
+		return err
+	}
+
+	var prunable []objects.LooseObject
+	var keptRecent int
+	var totalSize, prunedSize int64
+	for _, obj := range loose {
+		totalSize += obj.Size
+		if reachable[obj.Hash] {
+			continue
+		}
+		if obj.ModTime.After(opts.PruneBefore) {
+			keptRecent++
+			continue
+		}
+		prunable = append(prunable, obj)
+		prunedSize += obj.Size
+	}
+	for _, obj := range garbage {
+		if obj.ModTime.Before(opts.PruneBefore) {
+			prunable = append(prunable, obj)
+			prunedSize += obj.Size
+		}
+	}
+
+	verb := "Removed"
+	if opts.DryRun {
+		verb = "Would remove"
+	}
+	for _, obj := range prunable {
+		name := obj.Hash
+		if name == "" {
+			name = obj.Path + " (temporary file)"
+		}
+		if opts.DryRun {
+			fmt.Printf("would prune %s (%s)\n", name, utils.FormatSize(obj.Size))
+			continue
+		}
+		if err := store.RemoveLoose(obj.Path); err != nil {
+			return err
+		}
+	}
+
+	for hash := range missing {
+		fmt.Printf("warning: reachable object %s is missing\n", hash)
+	}
+	fmt.Printf("%d loose objects (%s), %d reachable\n", len(loose), utils.FormatSize(totalSize), len(reachable))
+	fmt.Printf("%s %d unreachable objects (%s)\n", verb, len(prunable), utils.FormatSize(prunedSize))
+	if keptRecent > 0 {
+		fmt.Printf("Kept %d unreachable objects newer than the grace period\n", keptRecent)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/ignore"
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+	"gopkg.in/ini.v1"
+)
+
+// newIgnoreMatcher builds the matcher for a repository, including the
+// global excludes file named by core.excludesfile in ~/.drift/config.
+func newIgnoreMatcher(repoRoot string) (*ignore.Matcher, error) {
+	homeDir, _ := os.UserHomeDir()
+	excludesFile := ""
+	cfg, err := ini.LooseLoad(filepath.Join(homeDir, ".drift", "config"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading global config: %v", err)
+	}
+	if path := cfg.Section("core").Key("excludesfile").String(); path != "" {
+		if strings.HasPrefix(path, "~/") {
+			path = filepath.Join(homeDir, path[2:])
+		}
+		excludesFile = path
+	}
+	return ignore.New(repoRoot, excludesFile)
+}
+
+// trackedDirs returns every directory that contains a tracked file, so
+// that ignored directories holding tracked files are still visited.
+func trackedDirs(idx *index.Index) map[string]bool {
+	dirs := map[string]bool{}
+	for _, e := range idx.Entries() {
+		dir := filepath.ToSlash(filepath.Dir(e.Path))
+		for dir != "." && !dirs[dir] {
+			dirs[dir] = true
+			dir = filepath.ToSlash(filepath.Dir(dir))
+		}
+	}
+	return dirs
+}
+
+func (c *Context) CheckIgnore(paths []string, verbose bool) (bool, error) {
+	if err := utils.CheckInitialized(); err != nil {
+		return false, err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return false, err
+	}
+	matcher, err := newIgnoreMatcher(repoRoot)
+	if err != nil {
+		return false, err
+	}
+
+	anyIgnored := false
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve absolute path: %v", err)
+		}
+		rel, err := filepath.Rel(repoRoot, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return false, fmt.Errorf("%s is outside repository at '%s'", p, repoRoot)
+		}
+		info, err := os.Stat(abs)
+		isDir := err == nil && info.IsDir()
+
+		pattern, matched := matcher.Match(rel, isDir)
+		if !matched || pattern.Negate {
+			continue
+		}
+		anyIgnored = true
+		if verbose {
+			fmt.Printf("%s:%d:%s\t%s\n", pattern.Source, pattern.Line, pattern.Text, p)
+		} else {
+			fmt.Println(p)
+		}
+	}
+	return anyIgnored, nil
+}
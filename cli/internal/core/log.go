@@ -0,0 +1,165 @@
+package core
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type LogOptions struct {
+	Oneline  bool
+	MaxCount int
+	Since    time.Time
+	Until    time.Time
+	Author   string
+	// Revs selects the commits to show, as accepted by resolveRange. It
+	// defaults to HEAD.
+	Revs  []string
+	Color bool
+}
+
+// commitQueue orders commits newest first so that history with several
+// parents is printed in committer-date order.
+type commitQueue []*utils.CommitObject
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)   { *q = append(*q, x.(*utils.CommitObject)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+func (c *Context) Log(opts LogOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	revs := opts.Revs
+	if len(revs) == 0 {
+		head, err := utils.ResolveHead(repoRoot)
+		if err != nil {
+			return err
+		}
+		if head == "" {
+			return fmt.Errorf("your current branch does not have any commits yet")
+		}
+		revs = []string{head}
+	}
+	r, err := resolveRange(repoRoot, revs)
+	if err != nil {
+		return err
+	}
+
+	var authorRe *regexp.Regexp
+	if opts.Author != "" {
+		authorRe, err = regexp.Compile("(?i)" + opts.Author)
+		if err != nil {
+			return fmt.Errorf("invalid --author pattern: %v", err)
+		}
+	}
+
+	// Commits reachable from an excluded revision are never shown or
+	// walked through.
+	seen := map[string]bool{}
+	for _, hash := range r.exclude {
+		hidden, err := utils.Ancestors(repoRoot, hash)
+		if err != nil {
+			return err
+		}
+		for h := range hidden {
+			seen[h] = true
+		}
+	}
+	queue := &commitQueue{}
+	for _, hash := range r.include {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		start, err := utils.ReadCommit(repoRoot, hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, start)
+	}
+	shown := 0
+
+	for queue.Len() > 0 {
+		if opts.MaxCount > 0 && shown >= opts.MaxCount {
+			break
+		}
+		commit := heap.Pop(queue).(*utils.CommitObject)
+
+		for _, parent := range commit.Parents {
+			if seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			pc, err := utils.ReadCommit(repoRoot, parent)
+			if err != nil {
+				return fmt.Errorf("failed to read parent of %s: %v", commit.Hash, err)
+			}
+			heap.Push(queue, pc)
+		}
+
+		when := commit.Committer.When
+		if !opts.Until.IsZero() && when.After(opts.Until) {
+			continue
+		}
+		if !opts.Since.IsZero() && when.Before(opts.Since) {
+			// Everything still queued is older than this commit.
+			break
+		}
+		if authorRe != nil {
+			ident := fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+			if !authorRe.MatchString(ident) {
+				continue
+			}
+		}
+
+		printCommit(commit, opts)
+		shown++
+	}
+
+	return nil
+}
+
+func printCommit(commit *utils.CommitObject, opts LogOptions) {
+	if opts.Oneline {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Printf("%s %s\n", colorize(opts.Color, "33", commit.Hash[:7]), subject)
+		return
+	}
+
+	fmt.Println(colorize(opts.Color, "33", "commit "+commit.Hash))
+	if len(commit.Parents) > 1 {
+		short := make([]string, len(commit.Parents))
+		for i, p := range commit.Parents {
+			short[i] = p[:7]
+		}
+		fmt.Printf("Merge: %s\n", strings.Join(short, " "))
+	}
+	fmt.Printf("Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	fmt.Printf("Date:   %s\n", commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	fmt.Println()
+	for _, line := range strings.Split(commit.Message, "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,254 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/media"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type MediaListOptions struct {
+	Color bool
+}
+
+type MediaPruneOptions struct {
+	DryRun bool
+}
+
+// openMedia returns the content behind a pointer, fetching it from the
+// configured source first when it is not in the local store.
+func openMedia(repoRoot string, p media.Pointer) (io.ReadCloser, error) {
+	store := media.NewStore(repoRoot)
+	if !store.Has(p.OID) {
+		cfg, err := media.LoadConfig(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		fetcher, err := media.NewFetcher(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if fetcher == nil {
+			return nil, fmt.Errorf("media object %s is not available locally and no media.source is configured", p.OID)
+		}
+		if err := fetcher.Fetch(p, store); err != nil {
+			return nil, err
+		}
+	}
+	return store.Open(p.OID)
+}
+
+// worktreePointer returns the pointer a working copy would be stored as,
+// and false if the path is not stored as media.
+func worktreePointer(repoRoot, path string, info os.FileInfo) (media.Pointer, bool, error) {
+	if !info.Mode().IsRegular() {
+		return media.Pointer{}, false, nil
+	}
+	cfg, err := media.LoadConfig(repoRoot)
+	if err != nil {
+		return media.Pointer{}, false, err
+	}
+	if !cfg.Matches(path, info.Size()) {
+		return media.Pointer{}, false, nil
+	}
+	p, err := media.HashFile(filepath.Join(repoRoot, filepath.FromSlash(path)))
+	if err != nil {
+		return media.Pointer{}, false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return p, true, nil
+}
+
+// readPointer returns the pointer held by blob hash, and false if the blob
+// is ordinary content.
+func readPointer(store *objects.Store, hash string) (media.Pointer, bool, error) {
+	r, err := store.Open(hash)
+	if err != nil {
+		return media.Pointer{}, false, err
+	}
+	defer r.Close()
+	if r.Type != "blob" || r.Size > media.MaxPointerSize {
+		return media.Pointer{}, false, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return media.Pointer{}, false, err
+	}
+	p, ok := media.ParsePointer(data)
+	return p, ok, nil
+}
+
+// indexPointers returns the media pointers of the files in the index.
+func indexPointers(repoRoot string, idx *index.Index) (map[string]media.Pointer, error) {
+	store := objects.NewStore(repoRoot)
+	pointers := map[string]media.Pointer{}
+	for _, e := range idx.Entries() {
+		if e.Mode == index.ModeSymlink {
+			continue
+		}
+		p, ok, err := readPointer(store, e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pointers[e.Path] = p
+		}
+	}
+	return pointers, nil
+}
+
+// MediaList prints the files in the index that are stored as media, marked
+// "*" when their content is present locally and "-" when it is not.
+func (c *Context) MediaList(opts MediaListOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		return err
+	}
+	pointers, err := indexPointers(repoRoot, idx)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(pointers))
+	for p := range pointers {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	store := media.NewStore(repoRoot)
+	for _, path := range paths {
+		p := pointers[path]
+		mark := "-"
+		if store.Has(p.OID) {
+			mark = "*"
+		}
+		fmt.Printf("%s %s %s (%s)\n", colorize(opts.Color, "33", p.OID[:10]), mark, path, utils.FormatSize(p.Size))
+	}
+	return nil
+}
+
+// MediaFetch fetches the missing media of the files in the index, or of
+// the given paths, and writes it into the working tree where checkout left
+// a pointer in its place.
+func (c *Context) MediaFetch(paths []string) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	specs, err := parsePathspecs(repoRoot, paths)
+	if err != nil {
+		return err
+	}
+
+	store := objects.NewStore(repoRoot)
+	mediaStore := media.NewStore(repoRoot)
+	fetched, written := 0, 0
+	err = index.Update(repoRoot, func(idx *index.Index) error {
+		pointers, err := indexPointers(repoRoot, idx)
+		if err != nil {
+			return err
+		}
+		for path, p := range pointers {
+			if len(specs) > 0 && !matchAny(specs, path) {
+				continue
+			}
+			if !mediaStore.Has(p.OID) {
+				r, err := openMedia(repoRoot, p)
+				if err != nil {
+					return fmt.Errorf("cannot fetch %s: %v", path, err)
+				}
+				r.Close()
+				fetched++
+			}
+
+			// Replace a pointer left in the working tree by the content.
+			full := filepath.Join(repoRoot, filepath.FromSlash(path))
+			info, err := os.Lstat(full)
+			if err != nil || !info.Mode().IsRegular() || info.Size() > media.MaxPointerSize {
+				continue
+			}
+			data, err := os.ReadFile(full)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			if left, ok := media.ParsePointer(data); !ok || left != p {
+				continue
+			}
+			e, _ := idx.Get(path)
+			entry, err := writeWorktreeFile(repoRoot, store, utils.TreeEntry{Name: path, Mode: e.Mode, Hash: e.Hash})
+			if err != nil {
+				return err
+			}
+			idx.Add(entry)
+			written++
+		}
+		return unmatchedPathspec(specs)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fetched %d media objects, updated %d files\n", fetched, written)
+	return nil
+}
+
+// MediaPrune removes media content that no reachable commit, reflog entry
+// or the index refers to.
+func (c *Context) MediaPrune(opts MediaPruneOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	// As in gc, the repository lock keeps add from storing new media while
+	// the referenced set is collected.
+	lock, err := lockRepoExclusive(repoRoot)
+	if err != nil {
+		return fmt.Errorf("cannot prune media: %v", err)
+	}
+	defer lock.Unlock()
+
+	reachable, _, err := reachableObjects(repoRoot)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+	keep := map[string]bool{}
+	for hash := range reachable {
+		p, ok, err := readPointer(store, hash)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keep[p.OID] = true
+		}
+	}
+
+	removed, freed, err := media.NewStore(repoRoot).Prune(keep, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if opts.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d unreferenced media objects (%s)\n", verb, removed, utils.FormatSize(freed))
+	return nil
+}
@@ -0,0 +1,501 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/diff"
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/media"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// mergeState is what an unfinished merge records under .drift: the commit
+// being merged (MERGE_HEAD), the prepared message (MERGE_MSG), the paths
+// that still need resolving (MERGE_CONFLICTS) and where HEAD was before the
+// merge started (ORIG_HEAD).
+type mergeState struct {
+	Head      string
+	Message   string
+	Conflicts []string
+	OrigHead  string
+}
+
+func driftFile(repoRoot, name string) string {
+	return filepath.Join(repoRoot, ".drift", name)
+}
+
+// readMergeState returns nil when no merge is in progress.
+func readMergeState(repoRoot string) (*mergeState, error) {
+	head, err := os.ReadFile(driftFile(repoRoot, "MERGE_HEAD"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MERGE_HEAD: %v", err)
+	}
+
+	state := &mergeState{Head: strings.TrimSpace(string(head))}
+	if msg, err := os.ReadFile(driftFile(repoRoot, "MERGE_MSG")); err == nil {
+		state.Message = strings.TrimSpace(string(msg))
+	}
+	if orig, err := os.ReadFile(driftFile(repoRoot, "ORIG_HEAD")); err == nil {
+		state.OrigHead = strings.TrimSpace(string(orig))
+	}
+	if data, err := os.ReadFile(driftFile(repoRoot, "MERGE_CONFLICTS")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				state.Conflicts = append(state.Conflicts, line)
+			}
+		}
+	}
+	return state, nil
+}
+
+func writeMergeState(repoRoot string, state *mergeState) error {
+	files := map[string]string{
+		"MERGE_HEAD": state.Head + "\n",
+		"MERGE_MSG":  state.Message + "\n",
+		"ORIG_HEAD":  state.OrigHead + "\n",
+	}
+	if len(state.Conflicts) > 0 {
+		files["MERGE_CONFLICTS"] = strings.Join(state.Conflicts, "\n") + "\n"
+	}
+	for name, content := range files {
+		if err := os.WriteFile(driftFile(repoRoot, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func clearMergeState(repoRoot string) {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_CONFLICTS"} {
+		os.Remove(driftFile(repoRoot, name))
+	}
+}
+
+// unresolvedConflicts returns the conflicted paths whose working copy has
+// not been staged yet or still contains conflict markers. Deleting the file
+// without staging it also counts as a resolution.
+func unresolvedConflicts(repoRoot string, idx *index.Index, conflicts []string) ([]string, error) {
+	unresolved := []string{}
+	for _, p := range conflicts {
+		content, err := os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(p)))
+		entry, staged := idx.Get(p)
+		if os.IsNotExist(err) {
+			if staged {
+				unresolved = append(unresolved, p)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", p, err)
+		}
+		if !staged || entry.Hash != objects.Hash("blob", content) ||
+			diff.HasConflictMarkers(string(content)) {
+			unresolved = append(unresolved, p)
+		}
+	}
+	return unresolved, nil
+}
+
+type mergeAction int
+
+const (
+	takeTheirs mergeAction = iota
+	mergeContent
+	conflictDeletedByThem
+	conflictDeletedByUs
+)
+
+type mergeStep struct {
+	path   string
+	action mergeAction
+	base   utils.TreeEntry
+	ours   utils.TreeEntry
+	theirs utils.TreeEntry
+	hasB   bool
+	hasO   bool
+	hasT   bool
+}
+
+func (c *Context) Merge(name string) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if state, err := readMergeState(repoRoot); err != nil {
+		return err
+	} else if state != nil {
+		return fmt.Errorf(
+			"you have not concluded your merge (MERGE_HEAD exists).\n" +
+				"Run 'drift merge --continue' to finish it or 'drift merge --abort' to give up",
+		)
+	}
+
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	theirs, err := resolveCommit(repoRoot, name)
+	if err != nil {
+		return err
+	}
+
+	if head == "" || head == theirs {
+		if head == theirs {
+			fmt.Println("Already up to date.")
+			return nil
+		}
+		if err := checkoutTree(repoRoot, head, theirs, false); err != nil {
+			return err
+		}
+		return updateHead(repoRoot, theirs, head, fmt.Sprintf("merge %s: Fast-forward", name))
+	}
+
+	if upToDate, err := utils.IsAncestor(repoRoot, theirs, head); err != nil {
+		return err
+	} else if upToDate {
+		fmt.Println("Already up to date.")
+		return nil
+	}
+
+	base, err := utils.MergeBase(repoRoot, head, theirs)
+	if err != nil {
+		return err
+	}
+
+	if base == head {
+		fmt.Printf("Updating %s..%s\n", head[:7], theirs[:7])
+		if err := checkoutTree(repoRoot, head, theirs, false); err != nil {
+			return err
+		}
+		if err := updateHead(repoRoot, theirs, head, fmt.Sprintf("merge %s: Fast-forward", name)); err != nil {
+			return err
+		}
+		fmt.Println("Fast-forward")
+		return nil
+	}
+
+	msg := fmt.Sprintf("Merge commit '%s'", theirs[:7])
+	if branchExists(repoRoot, name) {
+		msg = fmt.Sprintf("Merge branch '%s'", name)
+	}
+
+	conflicts, err := mergeTrees(repoRoot, base, head, theirs, name, "merge")
+	if err != nil {
+		return err
+	}
+
+	state := &mergeState{Head: theirs, Message: msg, Conflicts: conflicts, OrigHead: head}
+	if err := writeMergeState(repoRoot, state); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf(
+			"Automatic merge failed; fix conflicts, 'drift add' the results and run 'drift merge --continue'",
+		)
+	}
+
+	if err := c.Commit(msg, CommitOptions{}); err != nil {
+		return err
+	}
+	fmt.Println("Merge made by the 'three-way' strategy.")
+	return nil
+}
+
+// mergeTrees applies the changes between base and theirs on top of ours
+// (the current HEAD) in the index and working tree, and returns the paths
+// that conflicted. op names the command in refusals, e.g. "merge".
+func mergeTrees(repoRoot, base, ours, theirs, theirsLabel, op string) ([]string, error) {
+	baseFiles, err := commitFiles(repoRoot, base)
+	if err != nil {
+		return nil, err
+	}
+	ourFiles, err := commitFiles(repoRoot, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirFiles, err := commitFiles(repoRoot, theirs)
+	if err != nil {
+		return nil, err
+	}
+	store := objects.NewStore(repoRoot)
+
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, files := range []map[string]utils.TreeEntry{baseFiles, ourFiles, theirFiles} {
+		for p := range files {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	conflicts := []string{}
+	err = index.Update(repoRoot, func(idx *index.Index) error {
+		if err := requireIndexMatches(idx, ourFiles, op); err != nil {
+			return err
+		}
+
+		steps := []mergeStep{}
+		for _, p := range paths {
+			b, hasB := baseFiles[p]
+			o, hasO := ourFiles[p]
+			t, hasT := theirFiles[p]
+			step := mergeStep{path: p, base: b, ours: o, theirs: t, hasB: hasB, hasO: hasO, hasT: hasT}
+
+			switch {
+			case sameEntry(o, t, hasO, hasT), sameEntry(b, t, hasB, hasT):
+				continue
+			case sameEntry(b, o, hasB, hasO):
+				step.action = takeTheirs
+			case hasO && hasT:
+				step.action = mergeContent
+			case hasO:
+				step.action = conflictDeletedByThem
+			default:
+				step.action = conflictDeletedByUs
+			}
+
+			// The working copy of every path we are about to rewrite must
+			// match HEAD.
+			wHash, wOK, err := worktreeHash(repoRoot, p)
+			if err != nil {
+				return err
+			}
+			if wOK != hasO || (wOK && wHash != o.Hash) {
+				if hasO || (hasT && wHash != t.Hash) {
+					return fmt.Errorf(
+						"Your local changes to '%s' would be overwritten by %s.\n"+
+							"Please commit them before you %s.\nAborting",
+						p, op, op,
+					)
+				}
+			}
+			steps = append(steps, step)
+		}
+
+		for _, step := range steps {
+			conflict, err := applyMergeStep(repoRoot, store, idx, step, theirsLabel)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(conflict, "CONFLICT") {
+				// Conflicted paths stay out of the index until the user
+				// stages a resolution.
+				idx.Remove(step.path)
+				conflicts = append(conflicts, step.path)
+			}
+			if conflict != "" {
+				fmt.Println(conflict)
+			}
+		}
+		return nil
+	})
+	return conflicts, err
+}
+
+// requireIndexMatches refuses to merge on top of staged but uncommitted
+// changes.
+func requireIndexMatches(idx *index.Index, files map[string]utils.TreeEntry, op string) error {
+	dirty := idx.Len() != len(files)
+	for _, e := range idx.Entries() {
+		f, ok := files[e.Path]
+		if !ok || f.Hash != e.Hash || f.Mode != e.Mode {
+			dirty = true
+			break
+		}
+	}
+	if dirty {
+		return fmt.Errorf("you have staged changes; commit them before you %s", op)
+	}
+	return nil
+}
+
+// applyMergeStep performs one step of a merge and returns the message to
+// report for it, which starts with CONFLICT if the path could not be
+// merged automatically.
+func applyMergeStep(
+	repoRoot string,
+	store *objects.Store,
+	idx *index.Index,
+	step mergeStep,
+	theirsLabel string,
+) (string, error) {
+	p := step.path
+	switch step.action {
+	case takeTheirs:
+		if !step.hasT {
+			if err := removeWorktreeFile(repoRoot, p); err != nil {
+				return "", err
+			}
+			idx.Remove(p)
+			return "", nil
+		}
+		step.theirs.Name = p
+		entry, err := writeWorktreeFile(repoRoot, store, step.theirs)
+		if err != nil {
+			return "", err
+		}
+		idx.Add(entry)
+		return "", nil
+
+	case conflictDeletedByThem:
+		return fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in HEAD.", p, theirsLabel), nil
+
+	case conflictDeletedByUs:
+		step.theirs.Name = p
+		if _, err := writeWorktreeFile(repoRoot, store, step.theirs); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("CONFLICT (modify/delete): %s deleted in HEAD and modified in %s.", p, theirsLabel), nil
+	}
+
+	ours, err := readBlob(store, step.ours.Hash)
+	if err != nil {
+		return "", err
+	}
+	theirs, err := readBlob(store, step.theirs.Hash)
+	if err != nil {
+		return "", err
+	}
+	var base []byte
+	if step.hasB {
+		if base, err = readBlob(store, step.base.Hash); err != nil {
+			return "", err
+		}
+	}
+
+	kind := "content"
+	if !step.hasB {
+		kind = "add/add"
+	}
+	if step.ours.Mode == index.ModeSymlink || step.theirs.Mode == index.ModeSymlink {
+		return fmt.Sprintf("CONFLICT (%s): Merge conflict in %s (symlink, kept HEAD version)", kind, p), nil
+	}
+	if diff.IsBinary(ours) || diff.IsBinary(theirs) || diff.IsBinary(base) {
+		return fmt.Sprintf("CONFLICT (%s): Merge conflict in %s (binary file, kept HEAD version)", kind, p), nil
+	}
+	if isPointer(ours) || isPointer(theirs) || isPointer(base) {
+		return fmt.Sprintf("CONFLICT (%s): Merge conflict in %s (media file, kept HEAD version)", kind, p), nil
+	}
+
+	// An executable bit changed on one side only carries over.
+	mode := step.ours.Mode
+	if step.hasB && step.ours.Mode == step.base.Mode {
+		mode = step.theirs.Mode
+	}
+
+	result := diff.Merge3(string(base), string(ours), string(theirs), "HEAD", theirsLabel)
+	hash, err := store.Put("blob", []byte(result.Content))
+	if err != nil {
+		return "", err
+	}
+	entry, err := writeWorktreeFile(repoRoot, store, utils.TreeEntry{
+		Mode: mode,
+		Type: "blob",
+		Hash: hash,
+		Name: p,
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.Conflicts > 0 {
+		return fmt.Sprintf("CONFLICT (%s): Merge conflict in %s", kind, p), nil
+	}
+	idx.Add(entry)
+	return fmt.Sprintf("Auto-merging %s", p), nil
+}
+
+func isPointer(data []byte) bool {
+	_, ok := media.ParsePointer(data)
+	return ok
+}
+
+func readBlob(store *objects.Store, hash string) ([]byte, error) {
+	objType, data, err := store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "blob" {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", hash, objType)
+	}
+	return data, nil
+}
+
+// MergeAbort throws away an unfinished merge and restores ORIG_HEAD.
+func (c *Context) MergeAbort() error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	state, err := readMergeState(repoRoot)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("there is no merge to abort (MERGE_HEAD missing)")
+	}
+
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := checkoutTree(repoRoot, head, state.OrigHead, true); err != nil {
+		return err
+	}
+
+	origFiles, err := commitFiles(repoRoot, state.OrigHead)
+	if err != nil {
+		return err
+	}
+	for _, p := range state.Conflicts {
+		if _, ok := origFiles[p]; !ok {
+			if err := removeWorktreeFile(repoRoot, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if head != state.OrigHead {
+		if err := updateHead(repoRoot, state.OrigHead, head, "merge: abort, moving to ORIG_HEAD"); err != nil {
+			return err
+		}
+	}
+	clearMergeState(repoRoot)
+	return nil
+}
+
+// MergeContinue records the merge commit once every conflict is resolved.
+func (c *Context) MergeContinue() error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	state, err := readMergeState(repoRoot)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("there is no merge in progress (MERGE_HEAD missing)")
+	}
+	return c.Commit(state.Message, CommitOptions{})
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathspec is a command-line path argument, relative to the repository
+// root. It names a file, everything below a directory, or, if it contains
+// glob characters, every path matching the pattern or lying below a
+// directory that matches it.
+type pathspec struct {
+	arg     string
+	pattern string
+	glob    bool
+	matched bool
+}
+
+// parsePathspecs resolves args, which are relative to the current
+// directory, against repoRoot.
+func parsePathspecs(repoRoot string, args []string) ([]*pathspec, error) {
+	specs := make([]*pathspec, 0, len(args))
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve absolute path: %v", err)
+		}
+		rel, err := filepath.Rel(repoRoot, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is outside the repository", arg)
+		}
+		pattern := filepath.ToSlash(rel)
+		glob := strings.ContainsAny(arg, "*?[")
+		if glob {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", arg, err)
+			}
+		}
+		specs = append(specs, &pathspec{arg: arg, pattern: pattern, glob: glob})
+	}
+	return specs, nil
+}
+
+func (s *pathspec) match(p string) bool {
+	if !s.glob {
+		return pathHasPrefix(p, s.pattern)
+	}
+	for dir := p; dir != "."; dir = path.Dir(dir) {
+		if ok, _ := path.Match(s.pattern, dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether any spec matches p, and marks those that do.
+func matchAny(specs []*pathspec, p string) bool {
+	found := false
+	for _, s := range specs {
+		if s.match(p) {
+			s.matched = true
+			found = true
+		}
+	}
+	return found
+}
+
+// unmatchedPathspec returns an error naming the first spec that matched
+// nothing.
+func unmatchedPathspec(specs []*pathspec) error {
+	for _, s := range specs {
+		if !s.matched {
+			return fmt.Errorf("pathspec '%s' did not match any files", s.arg)
+		}
+	}
+	return nil
+}
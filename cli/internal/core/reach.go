@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// refRoots returns the object ids named by every ref, HEAD and the
+// pseudo-refs of an unfinished merge, keyed by the name they came from.
+func refRoots(repoRoot string) (map[string]string, error) {
+	roots := map[string]string{}
+
+	names, err := refs.List(repoRoot, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		hash, err := refs.Read(repoRoot, "refs/"+name)
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" {
+			roots["refs/"+name] = hash
+		}
+	}
+
+	if head, err := utils.ResolveHead(repoRoot); err != nil {
+		return nil, err
+	} else if head != "" {
+		roots["HEAD"] = head
+	}
+	for _, name := range []string{"ORIG_HEAD", "MERGE_HEAD"} {
+		if data, err := os.ReadFile(driftFile(repoRoot, name)); err == nil {
+			if hash := strings.TrimSpace(string(data)); hash != "" {
+				roots[name] = hash
+			}
+		}
+	}
+	return roots, nil
+}
+
+// reflogRoots returns every object id recorded in .drift/log.
+func reflogRoots(repoRoot string) ([]string, error) {
+	hashes := []string{}
+	logDir := driftFile(repoRoot, "log")
+	err := filepath.WalkDir(logDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			for _, field := range fields[:min(2, len(fields))] {
+				if fullHashRe.MatchString(field) && field != utils.ZeroHash {
+					hashes = append(hashes, field)
+				}
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reflogs: %v", err)
+	}
+	return hashes, nil
+}
+
+// reachableObjects marks every object reachable from refs, the index and
+// the reflogs. Missing objects are reported through missing rather than
+// failing the walk.
+func reachableObjects(repoRoot string) (reachable map[string]bool, missing map[string]bool, err error) {
+	store := objects.NewStore(repoRoot)
+	reachable = map[string]bool{}
+	missing = map[string]bool{}
+
+	stack := []string{}
+	roots, err := refRoots(repoRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, hash := range roots {
+		stack = append(stack, hash)
+	}
+	logged, err := reflogRoots(repoRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	stack = append(stack, logged...)
+
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range idx.Entries() {
+		stack = append(stack, e.Hash)
+	}
+
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[hash] || missing[hash] {
+			continue
+		}
+		if !store.Has(hash) {
+			missing[hash] = true
+			continue
+		}
+		reachable[hash] = true
+
+		children, err := objectLinks(store, hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		stack = append(stack, children...)
+	}
+	return reachable, missing, nil
+}
+
+// objectLinks returns the ids an object refers to.
+func objectLinks(store *objects.Store, hash string) ([]string, error) {
+	objType, err := store.Type(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	switch objType {
+	case "commit":
+		_, data, err := store.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := utils.ParseCommit(hash, data)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{commit.Tree}, commit.Parents...), nil
+	case "tree":
+		_, data, err := store.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := utils.ParseTree(data)
+		if err != nil {
+			return nil, err
+		}
+		links := make([]string, len(entries))
+		for i, e := range entries {
+			links[i] = e.Hash
+		}
+		return links, nil
+	case "tag":
+		_, data, err := store.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := utils.ParseTag(hash, data)
+		if err != nil {
+			return nil, err
+		}
+		return []string{tag.Object}, nil
+	case "blob":
+		return store.Chunks(hash)
+	}
+	return nil, nil
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// defaultReflogExpiry is how long reflog expire keeps entries by default.
+const defaultReflogExpiry = 90 * 24 * time.Hour
+
+type ReflogShowOptions struct {
+	Color bool
+}
+
+type ReflogExpireOptions struct {
+	// Expire drops entries older than this time; zero means 90 days ago.
+	Expire time.Time
+	// All expires every reflog instead of the named ones.
+	All bool
+}
+
+// writeRef moves ref from old ("" when creating it) to hash, failing if
+// another process moved it first, and records the move in its reflog, and
+// in HEAD's when HEAD is attached to ref.
+func writeRef(repoRoot, ref, hash, old, reason string) error {
+	if err := refs.Update(repoRoot, ref, hash, old); err != nil {
+		return err
+	}
+	if err := utils.AppendReflog(repoRoot, ref, old, hash, reason); err != nil {
+		return err
+	}
+	headRef, _, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	if headRef == ref {
+		return utils.AppendReflog(repoRoot, "HEAD", old, hash, reason)
+	}
+	return nil
+}
+
+// deleteRef removes ref, provided it still holds old, together with its
+// reflog.
+func deleteRef(repoRoot, ref, old string) error {
+	if err := refs.Delete(repoRoot, ref, old); err != nil {
+		return err
+	}
+	return utils.DeleteReflog(repoRoot, ref)
+}
+
+// moveHead attaches HEAD to a branch ref or detaches it at a commit, and
+// records the move in HEAD's reflog.
+func moveHead(repoRoot, target, reason string) error {
+	_, old, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := refs.SetHead(repoRoot, target); err != nil {
+		return err
+	}
+	_, now, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	return utils.AppendReflog(repoRoot, "HEAD", old, now, reason)
+}
+
+// headName describes where HEAD is for reflog messages: the branch name,
+// or the commit id when detached.
+func headName(repoRoot string) (string, error) {
+	ref, hash, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	if ref != "" {
+		return shortRefName(ref), nil
+	}
+	return hash, nil
+}
+
+// reflogRef maps a name given on the command line or before @{n} to the
+// ref whose reflog it means: HEAD, or a full ref name.
+func reflogRef(repoRoot, name string) (string, error) {
+	if name == "" || name == "HEAD" || name == "@" {
+		return "HEAD", nil
+	}
+	ref, err := lookupRef(repoRoot, name)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("unknown ref %q", name)
+	}
+	return ref, nil
+}
+
+// resolveReflogEntry resolves <name>@{n}: the value name had n moves ago.
+// A bare @{n} uses the current branch, or HEAD when detached.
+func resolveReflogEntry(repoRoot, name string, n int) (string, error) {
+	ref := "HEAD"
+	if name == "" {
+		current, err := utils.CurrentBranch(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if current != "" {
+			ref = utils.BranchPrefix + current
+		}
+	} else {
+		var err error
+		if ref, err = reflogRef(repoRoot, name); err != nil {
+			return "", err
+		}
+	}
+
+	entries, err := utils.ReadReflog(repoRoot, ref)
+	if err != nil {
+		return "", err
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("log for '%s' only has %d entries", shortRefName(ref), len(entries))
+	}
+	hash := entries[len(entries)-1-n].New
+	if hash == utils.ZeroHash {
+		return "", fmt.Errorf("%s@{%d} does not point at a commit", shortRefName(ref), n)
+	}
+	return hash, nil
+}
+
+// ReflogShow prints the reflog of ref, newest entry first.
+func (c *Context) ReflogShow(name string, opts ReflogShowOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	ref, err := reflogRef(repoRoot, name)
+	if err != nil {
+		return err
+	}
+	entries, err := utils.ReadReflog(repoRoot, ref)
+	if err != nil {
+		return err
+	}
+
+	label := strings.TrimPrefix(shortRefName(strings.TrimPrefix(ref, utils.TagPrefix)), "refs/")
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		fmt.Printf("%s %s@{%d}: %s\n", colorize(opts.Color, "33", e.New[:7]), label, len(entries)-1-i, e.Message)
+	}
+	return nil
+}
+
+// ReflogExpire drops reflog entries older than opts.Expire from the named
+// refs, or from every reflog with opts.All.
+func (c *Context) ReflogExpire(names []string, opts ReflogExpireOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	cutoff := opts.Expire
+	if cutoff.IsZero() {
+		cutoff = time.Now().Add(-defaultReflogExpiry)
+	}
+
+	logged := []string{}
+	if opts.All {
+		if logged, err = utils.ListReflogs(repoRoot); err != nil {
+			return err
+		}
+	} else {
+		if len(names) == 0 {
+			names = []string{"HEAD"}
+		}
+		for _, name := range names {
+			ref, err := reflogRef(repoRoot, name)
+			if err != nil {
+				return err
+			}
+			logged = append(logged, ref)
+		}
+	}
+
+	for _, ref := range logged {
+		entries, err := utils.ReadReflog(repoRoot, ref)
+		if err != nil {
+			return err
+		}
+		kept := []utils.ReflogEntry{}
+		for _, e := range entries {
+			if e.Who.When.After(cutoff) {
+				kept = append(kept, e)
+			}
+		}
+		// The newest entry of a ref that still exists is always kept, or
+		// @{0}, and with it stash@{0}, would stop resolving.
+		if len(kept) == 0 && len(entries) > 0 {
+			exists, err := refExists(repoRoot, ref)
+			if err != nil {
+				return err
+			}
+			if exists {
+				kept = entries[len(entries)-1:]
+			}
+		}
+		if len(kept) == len(entries) {
+			continue
+		}
+		if err := utils.WriteReflog(repoRoot, ref, kept); err != nil {
+			return err
+		}
+		fmt.Printf("Expired %d of %d entries from %s\n", len(entries)-len(kept), len(entries), ref)
+	}
+	return nil
+}
+
+// refExists reports whether ref, or HEAD, currently points at something.
+func refExists(repoRoot, ref string) (bool, error) {
+	if ref == "HEAD" {
+		_, hash, err := utils.ReadHead(repoRoot)
+		return hash != "", err
+	}
+	hash, err := refs.Read(repoRoot, ref)
+	return hash != "", err
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+)
+
+func TestReflogExpireKeepsNewestEntry(t *testing.T) {
+	c, repoRoot := initTestRepo(t)
+	if err := os.WriteFile("f", []byte("base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add("f", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Commit("base", CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"one\n", "two\n"} {
+		if err := os.WriteFile("f", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.StashPush(StashPushOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A cutoff in the future makes every entry old enough to expire.
+	if err := c.ReflogExpire(nil, ReflogExpireOptions{Expire: time.Now().Add(time.Hour), All: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	stash, err := refs.Read(repoRoot, stashRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := stashEntries(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].New != stash {
+		t.Fatalf("stash entries after expiry = %+v, want only the one %s points at", entries, stashRef)
+	}
+	for _, rev := range []string{"stash@{0}", "HEAD@{0}", "main@{0}"} {
+		if _, err := resolveRevision(repoRoot, rev); err != nil {
+			t.Errorf("%s after expiry: %v", rev, err)
+		}
+	}
+	if err := c.StashList(StashListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StashApply("stash@{0}", true); err != nil {
+		t.Fatalf("popping the last stash after expiry: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// packNameHints maps blob and tree ids to the file name they appear under,
+// so that versions of the same file are tried as delta bases for each
+// other.
+func packNameHints(store *objects.Store, ids map[string]bool) (map[string]string, error) {
+	hints := map[string]string{}
+	for id := range ids {
+		r, err := store.Open(id)
+		if err != nil {
+			return nil, err
+		}
+		objType := r.Type
+		r.Close()
+		if objType != "tree" {
+			continue
+		}
+		_, data, err := store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := utils.ParseTree(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if _, ok := hints[e.Hash]; !ok {
+				hints[e.Hash] = e.Name
+			}
+		}
+	}
+	return hints, nil
+}
+
+func (c *Context) Repack() error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepoExclusive(repoRoot)
+	if err != nil {
+		return fmt.Errorf("cannot repack: %v", err)
+	}
+	defer lock.Unlock()
+
+	reachable, missing, err := reachableObjects(repoRoot)
+	if err != nil {
+		return err
+	}
+	for hash := range missing {
+		fmt.Printf("warning: reachable object %s is missing\n", hash)
+	}
+
+	store := objects.NewStore(repoRoot)
+	oldPacks, err := store.Packs()
+	if err != nil {
+		return err
+	}
+	// Only reachable objects go into the new pack. Unreachable ones in the
+	// old packs are written back loose, dated like the pack they came from,
+	// so that gc prunes them once they outlive its grace period instead of
+	// each repack carrying them over with a fresh date.
+	unpacked := 0
+	for _, p := range oldPacks {
+		info, err := os.Stat(p.Path())
+		if err != nil {
+			return fmt.Errorf("error reading pack %s: %v", p.Name, err)
+		}
+		for _, id := range p.IDs() {
+			if reachable[id] {
+				continue
+			}
+			if err := store.Loosen(id, info.ModTime()); err != nil {
+				return err
+			}
+			unpacked++
+		}
+	}
+	include := map[string]bool{}
+	for id := range reachable {
+		include[id] = true
+	}
+	// Chunked blobs stay loose: their chunks are packed on their own and
+	// stay shared, where packing the blob would store its content whole.
+	for id := range include {
+		chunked, err := store.IsChunked(id)
+		if err != nil {
+			return err
+		}
+		if chunked {
+			delete(include, id)
+		}
+	}
+	if len(include) == 0 {
+		for _, p := range oldPacks {
+			if err := store.RemovePack(p); err != nil {
+				return err
+			}
+		}
+		fmt.Println("Nothing to pack")
+		printUnpacked(unpacked)
+		return nil
+	}
+
+	hints, err := packNameHints(store, include)
+	if err != nil {
+		return err
+	}
+	candidates := make([]objects.PackCandidate, 0, len(include))
+	for id := range include {
+		candidates = append(candidates, objects.PackCandidate{ID: id, NameHint: hints[id]})
+	}
+
+	name, deltas, err := store.WritePack(candidates)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range oldPacks {
+		if p.Name == name {
+			continue
+		}
+		if err := store.RemovePack(p); err != nil {
+			return err
+		}
+	}
+
+	loose, _, err := store.Loose()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	var freed int64
+	for _, obj := range loose {
+		if !include[obj.Hash] {
+			continue
+		}
+		if err := store.RemoveLoose(obj.Path); err != nil {
+			return err
+		}
+		removed++
+		freed += obj.Size
+	}
+
+	info, err := os.Stat(filepath.Join(store.Dir(), "pack", name+".pack"))
+	if err != nil {
+		return fmt.Errorf("error reading new pack: %v", err)
+	}
+	fmt.Printf("Packed %d objects (%d as deltas) into %s (%s)\n", len(candidates), deltas, name, utils.FormatSize(info.Size()))
+	fmt.Printf("Removed %d loose objects (%s)\n", removed, utils.FormatSize(freed))
+	printUnpacked(unpacked)
+	return nil
+}
+
+func printUnpacked(n int) {
+	if n > 0 {
+		fmt.Printf("Unpacked %d unreachable objects for gc to prune\n", n)
+	}
+}
+
+// PackRefs moves loose tags, or every loose ref when all is set, into
+// .drift/packed-refs, so that repositories with many refs do not keep a
+// file for each.
+func (c *Context) PackRefs(all bool) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	prefix := utils.TagPrefix
+	if all {
+		prefix = "refs/"
+	}
+	n, err := refs.Pack(repoRoot, prefix)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Packed %d refs\n", n)
+	return nil
+}
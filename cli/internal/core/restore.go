@@ -0,0 +1,261 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type RestoreOptions struct {
+	// Source is the commit to restore from. It defaults to the index for
+	// the working tree and to HEAD for --staged.
+	Source   string
+	Staged   bool
+	Worktree bool
+}
+
+type RmOptions struct {
+	Cached    bool
+	Recursive bool
+	Force     bool
+}
+
+// restoreSource returns the files a restore copies from: the named commit,
+// or the index when source is "".
+func restoreSource(repoRoot, source string, idx *index.Index) (map[string]utils.TreeEntry, error) {
+	if source == "" {
+		files := map[string]utils.TreeEntry{}
+		for _, e := range idx.Entries() {
+			files[e.Path] = utils.TreeEntry{Mode: e.Mode, Type: "blob", Hash: e.Hash, Name: e.Path}
+		}
+		return files, nil
+	}
+	hash, err := resolveCommit(repoRoot, source)
+	if err != nil {
+		return nil, err
+	}
+	return commitFiles(repoRoot, hash)
+}
+
+// Restore rewrites working files and/or index entries matching paths from
+// the source. Tracked paths that do not exist in the source are removed.
+func (c *Context) Restore(paths []string, opts RestoreOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if !opts.Staged && !opts.Worktree {
+		opts.Worktree = true
+	}
+
+	// --staged restores from HEAD by default. On an unborn branch there is
+	// nothing to restore from, so the matching entries are simply dropped.
+	source := opts.Source
+	unborn := false
+	if source == "" && opts.Staged {
+		if source, err = utils.ResolveHead(repoRoot); err != nil {
+			return err
+		}
+		unborn = source == ""
+	}
+
+	specs, err := parsePathspecs(repoRoot, paths)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+
+	return index.Update(repoRoot, func(idx *index.Index) error {
+		files := map[string]utils.TreeEntry{}
+		if !unborn {
+			files, err = restoreSource(repoRoot, source, idx)
+			if err != nil {
+				return err
+			}
+		}
+
+		targets := map[string]bool{}
+		for p := range files {
+			if matchAny(specs, p) {
+				targets[p] = true
+			}
+		}
+		// Tracked paths missing from the source are removed, except when
+		// restoring the working tree from the index, where they cannot be.
+		if opts.Staged || source != "" {
+			for _, e := range idx.Entries() {
+				if matchAny(specs, e.Path) {
+					targets[e.Path] = true
+				}
+			}
+		}
+		if err := unmatchedPathspec(specs); err != nil {
+			return err
+		}
+
+		sorted := make([]string, 0, len(targets))
+		for p := range targets {
+			sorted = append(sorted, p)
+		}
+		sort.Strings(sorted)
+
+		for _, p := range sorted {
+			src, ok := files[p]
+			src.Name = p
+			if opts.Worktree {
+				if !ok {
+					if err := removeWorktreeFile(repoRoot, p); err != nil {
+						return err
+					}
+				} else {
+					entry, err := writeWorktreeFile(repoRoot, store, src)
+					if err != nil {
+						return err
+					}
+					if opts.Staged || source == "" {
+						// The entry now matches the file just written,
+						// stat data included.
+						idx.Add(entry)
+						continue
+					}
+				}
+			}
+			if opts.Staged {
+				if !ok {
+					idx.Remove(p)
+					continue
+				}
+				if cur, tracked := idx.Get(p); tracked && cur.Hash == src.Hash && cur.Mode == src.Mode {
+					continue
+				}
+				// No stat data: the working copy will be re-hashed.
+				idx.Add(index.Entry{Path: p, Mode: src.Mode, Hash: src.Hash})
+			}
+		}
+		return nil
+	})
+}
+
+// Rm removes paths from the index and, unless opts.Cached is set, from
+// the working tree.
+func (c *Context) Rm(paths []string, opts RmOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	specs, err := parsePathspecs(repoRoot, paths)
+	if err != nil {
+		return err
+	}
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	headFiles, err := commitFiles(repoRoot, head)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	targets := []index.Entry{}
+	err = index.Update(repoRoot, func(idx *index.Index) error {
+		for _, e := range idx.Entries() {
+			if matchAny(specs, e.Path) {
+				targets = append(targets, e)
+			}
+		}
+		if err := unmatchedPathspec(specs); err != nil {
+			return err
+		}
+		if !opts.Recursive {
+			for _, s := range specs {
+				if s.glob {
+					continue
+				}
+				if _, ok := idx.Get(s.pattern); !ok {
+					return fmt.Errorf("not removing '%s' recursively without -r", s.arg)
+				}
+			}
+		}
+
+		if !opts.Force {
+			staged, modified := []string{}, []string{}
+			for _, e := range targets {
+				h, inHead := headFiles[e.Path]
+				stagedChange := !inHead || h.Hash != e.Hash
+				wHash, wOK, err := worktreeHash(repoRoot, e.Path)
+				if err != nil {
+					return err
+				}
+				localChange := wOK && wHash != e.Hash
+
+				switch {
+				case opts.Cached:
+					// Only refuse when the staged content exists nowhere
+					// else once the entry is dropped.
+					if stagedChange && localChange {
+						staged = append(staged, e.Path)
+					}
+				case stagedChange:
+					staged = append(staged, e.Path)
+				case localChange:
+					modified = append(modified, e.Path)
+				}
+			}
+			if len(staged) > 0 {
+				return fmt.Errorf(
+					"the following files have changes staged in the index:\n\t%s\n"+
+						"(use --cached to keep the file, or -f to force removal)",
+					strings.Join(staged, "\n\t"),
+				)
+			}
+			if len(modified) > 0 {
+				return fmt.Errorf(
+					"the following files have local modifications:\n\t%s\n"+
+						"(use --cached to keep the file, or -f to force removal)",
+					strings.Join(modified, "\n\t"),
+				)
+			}
+		}
+
+		for _, e := range targets {
+			idx.Remove(e.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files are only deleted once the index no longer tracks them, so a
+	// failed index write never leaves a tracked file missing.
+	for _, e := range targets {
+		if !opts.Cached {
+			if err := removeWorktreeFile(repoRoot, e.Path); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("rm '%s'\n", e.Path)
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+var abbrevHashRe = regexp.MustCompile(`^[0-9a-fA-F]{4,64}$`)
+
+// pseudoRefs are the HEAD-like files directly under .drift that a revision
+// may name.
+var pseudoRefs = []string{"ORIG_HEAD", "MERGE_HEAD"}
+
+// resolveRevision evaluates a revision expression to an object id:
+//
+//	HEAD, @             the current commit ("" means HEAD too)
+//	<name>              a ref, tried as refs/<name>, refs/tags/<name>,
+//	                    refs/heads/<name> and refs/remotes/<name>
+//	<hex>               a full or abbreviated (at least 4 digits) object id
+//	[<branch>]@{u}      the upstream of a branch, also @{upstream}
+//	[<ref>]@{<n>}       the value of a ref n moves ago, from its reflog;
+//	                    a bare @{n} uses the current branch
+//	<rev>~<n>           the n-th first-parent ancestor (n defaults to 1)
+//	<rev>^<n>           the n-th parent; ^0 peels to the commit itself
+//	<rev>^{}            peels annotated tags; ^{commit} and ^{tree} peel
+//	                    to that type
+//
+// Annotated tags named directly are returned unpeeled.
+func resolveRevision(repoRoot, expr string) (string, error) {
+	base, suffix := splitRevision(expr)
+	hash, err := resolveRevisionBase(repoRoot, base)
+	if err != nil {
+		return "", err
+	}
+
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			end := strings.IndexByte(suffix, '}')
+			if end < 0 {
+				return "", fmt.Errorf("invalid revision %q: unterminated ^{", expr)
+			}
+			want := suffix[1:end]
+			suffix = suffix[end+1:]
+			if hash, err = peelRevision(repoRoot, hash, want); err != nil {
+				return "", fmt.Errorf("%s: %v", expr, err)
+			}
+			continue
+		}
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return "", fmt.Errorf("invalid revision %q", expr)
+			}
+			suffix = suffix[digits:]
+		}
+
+		commitHash, err := peelRevision(repoRoot, hash, "commit")
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", expr, err)
+		}
+		switch op {
+		case '~':
+			for i := 0; i < n; i++ {
+				commit, err := utils.ReadCommit(repoRoot, commitHash)
+				if err != nil {
+					return "", err
+				}
+				if len(commit.Parents) == 0 {
+					return "", fmt.Errorf("invalid revision %q: commit %s has no parent", expr, commitHash[:7])
+				}
+				commitHash = commit.Parents[0]
+			}
+		case '^':
+			if n > 0 {
+				commit, err := utils.ReadCommit(repoRoot, commitHash)
+				if err != nil {
+					return "", err
+				}
+				if n > len(commit.Parents) {
+					return "", fmt.Errorf("invalid revision %q: commit %s has no parent %d", expr, commitHash[:7], n)
+				}
+				commitHash = commit.Parents[n-1]
+			}
+		default:
+			return "", fmt.Errorf("invalid revision %q", expr)
+		}
+		hash = commitHash
+	}
+	return hash, nil
+}
+
+// splitRevision separates the name part of expr from its ~ and ^ suffixes.
+func splitRevision(expr string) (string, string) {
+	// The suffixes start at the first ~ or ^ outside an @{...} block.
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '~', '^':
+			if depth == 0 {
+				return expr[:i], expr[i:]
+			}
+		}
+	}
+	return expr, ""
+}
+
+// peelRevision dereferences hash to an object of type want: "" peels
+// annotated tags only, "commit" and "tree" also step from tag to commit to
+// tree as needed.
+func peelRevision(repoRoot, hash, want string) (string, error) {
+	peeled, objType, err := utils.PeelTag(repoRoot, hash)
+	if err != nil {
+		return "", err
+	}
+	switch want {
+	case "":
+		return peeled, nil
+	case objType:
+		return peeled, nil
+	case "tree":
+		if objType == "commit" {
+			commit, err := utils.ReadCommit(repoRoot, peeled)
+			if err != nil {
+				return "", err
+			}
+			return commit.Tree, nil
+		}
+	case "commit", "blob", "tag":
+	default:
+		return "", fmt.Errorf("unknown object type %q", want)
+	}
+	return "", fmt.Errorf("%s is a %s, not a %s", hash[:7], objType, want)
+}
+
+func resolveRevisionBase(repoRoot, name string) (string, error) {
+	if at := strings.Index(name, "@{"); at >= 0 && strings.HasSuffix(name, "}") {
+		spec := name[at+2 : len(name)-1]
+		switch spec {
+		case "u", "upstream":
+			return resolveUpstream(repoRoot, name[:at])
+		}
+		if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+			return resolveReflogEntry(repoRoot, name[:at], n)
+		}
+		return "", fmt.Errorf("unsupported revision %q", name)
+	}
+
+	if name == "" || name == "HEAD" || name == "@" {
+		head, err := utils.ResolveHead(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if head == "" {
+			return "", fmt.Errorf("HEAD does not point at a commit yet")
+		}
+		return head, nil
+	}
+
+	ref, err := lookupRef(repoRoot, name)
+	if err != nil {
+		return "", err
+	}
+	if ref != "" {
+		return readRevisionRef(repoRoot, ref)
+	}
+
+	if abbrevHashRe.MatchString(name) {
+		matches, err := objects.NewStore(repoRoot).FindPrefix(strings.ToLower(name))
+		if err != nil {
+			return "", err
+		}
+		switch len(matches) {
+		case 0:
+		case 1:
+			return matches[0], nil
+		default:
+			return "", ambiguousPrefixError(repoRoot, name, matches)
+		}
+	}
+	return "", fmt.Errorf("unknown revision %q", name)
+}
+
+// lookupRef returns the full name of the ref that name refers to, "" if
+// there is none, or an error if name matches refs in more than one
+// namespace.
+func lookupRef(repoRoot, name string) (string, error) {
+	for _, pseudo := range pseudoRefs {
+		if name == pseudo {
+			if _, err := os.Stat(driftFile(repoRoot, pseudo)); err == nil {
+				return pseudo, nil
+			}
+			return "", nil
+		}
+	}
+	if err := utils.CheckRefName(name); err != nil {
+		return "", nil
+	}
+
+	candidates := []string{
+		"refs/" + name,
+		utils.TagPrefix + name,
+		utils.BranchPrefix + name,
+		utils.RemotePrefix + name,
+	}
+	if strings.HasPrefix(name, "refs/") {
+		candidates = []string{name}
+	}
+	found := []string{}
+	for _, ref := range candidates {
+		hash, err := refs.Read(repoRoot, ref)
+		if err != nil {
+			return "", err
+		}
+		if hash != "" {
+			found = append(found, ref)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf(
+		"refname '%s' is ambiguous; it could be:\n\t%s\nuse the full name to pick one",
+		name, strings.Join(found, "\n\t"),
+	)
+}
+
+func readRevisionRef(repoRoot, ref string) (string, error) {
+	for _, pseudo := range pseudoRefs {
+		if ref == pseudo {
+			data, err := os.ReadFile(driftFile(repoRoot, pseudo))
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %v", pseudo, err)
+			}
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return refs.Read(repoRoot, ref)
+}
+
+func ambiguousPrefixError(repoRoot, prefix string, matches []string) error {
+	store := objects.NewStore(repoRoot)
+	lines := make([]string, len(matches))
+	for i, id := range matches {
+		objType := "unknown"
+		if r, err := store.Open(id); err == nil {
+			objType = r.Type
+			r.Close()
+		}
+		lines[i] = fmt.Sprintf("%s %s", id[:12], objType)
+	}
+	return fmt.Errorf(
+		"short object id %s is ambiguous; the candidates are:\n\t%s",
+		prefix, strings.Join(lines, "\n\t"),
+	)
+}
+
+// resolveUpstream resolves <branch>@{upstream}; an empty branch means the
+// current one.
+func resolveUpstream(repoRoot, branch string) (string, error) {
+	if branch == "" || branch == "HEAD" {
+		current, err := utils.CurrentBranch(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if current == "" {
+			return "", fmt.Errorf("HEAD does not point to a branch")
+		}
+		branch = current
+	}
+	branch = strings.TrimPrefix(branch, utils.BranchPrefix)
+	if !branchExists(repoRoot, branch) {
+		return "", fmt.Errorf("no such branch: '%s'", branch)
+	}
+	ref, err := upstreamRef(repoRoot, branch)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+	}
+	hash, err := refs.Read(repoRoot, ref)
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return "", fmt.Errorf("upstream branch '%s' of '%s' is gone", shortRefName(ref), branch)
+	}
+	return hash, nil
+}
+
+// revRange is the set of commits named by a list of revision arguments:
+// everything reachable from include but not from exclude.
+type revRange struct {
+	include []string
+	exclude []string
+}
+
+// resolveRange evaluates arguments such as "B", "^A", "A..B" (reachable
+// from B but not A) and "A...B" (reachable from either but not both). An
+// empty side of a range means HEAD.
+func resolveRange(repoRoot string, args []string) (*revRange, error) {
+	r := &revRange{}
+	commit := func(expr string) (string, error) {
+		hash, err := resolveRevision(repoRoot, expr)
+		if err != nil {
+			return "", err
+		}
+		return peelRevision(repoRoot, hash, "commit")
+	}
+
+	for _, arg := range args {
+		if a, b, ok := strings.Cut(arg, "..."); ok {
+			left, err := commit(a)
+			if err != nil {
+				return nil, err
+			}
+			right, err := commit(b)
+			if err != nil {
+				return nil, err
+			}
+			r.include = append(r.include, right, left)
+			// After a criss-cross merge there are several merge bases,
+			// and whatever any of them reaches is common to both sides.
+			bases, err := utils.MergeBases(repoRoot, left, right)
+			if err != nil {
+				return nil, err
+			}
+			r.exclude = append(r.exclude, bases...)
+			continue
+		}
+		if a, b, ok := strings.Cut(arg, ".."); ok {
+			left, err := commit(a)
+			if err != nil {
+				return nil, err
+			}
+			right, err := commit(b)
+			if err != nil {
+				return nil, err
+			}
+			r.include = append(r.include, right)
+			r.exclude = append(r.exclude, left)
+			continue
+		}
+		if strings.HasPrefix(arg, "^") {
+			hash, err := commit(arg[1:])
+			if err != nil {
+				return nil, err
+			}
+			r.exclude = append(r.exclude, hash)
+			continue
+		}
+		hash, err := commit(arg)
+		if err != nil {
+			return nil, err
+		}
+		r.include = append(r.include, hash)
+	}
+	return r, nil
+}
+
+// rangeEnds returns the two commits a diff of arg compares: A and B for
+// "A..B", and the merge base of A and B and B for "A...B". An empty side
+// means HEAD.
+func rangeEnds(repoRoot, arg string) ([]string, error) {
+	if a, b, ok := strings.Cut(arg, "..."); ok {
+		left, err := resolveCommit(repoRoot, a)
+		if err != nil {
+			return nil, err
+		}
+		right, err := resolveCommit(repoRoot, b)
+		if err != nil {
+			return nil, err
+		}
+		base, err := utils.MergeBase(repoRoot, left, right)
+		if err != nil {
+			return nil, err
+		}
+		if base == "" {
+			return nil, fmt.Errorf("%s: no merge base", arg)
+		}
+		return []string{base, orHead(b)}, nil
+	}
+	a, b, _ := strings.Cut(arg, "..")
+	return []string{orHead(a), orHead(b)}, nil
+}
+
+func orHead(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+type RevParseOptions struct {
+	Short     bool
+	AbbrevRef bool
+	Verify    bool
+}
+
+// RevParse prints the object id each argument resolves to. Ranges print
+// their included ids followed by the excluded ones prefixed with ^.
+func (c *Context) RevParse(args []string, opts RevParseOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if opts.Verify && len(args) != 1 {
+		return fmt.Errorf("--verify needs exactly one revision")
+	}
+
+	format := func(hash string) string {
+		if opts.Short {
+			return hash[:7]
+		}
+		return hash
+	}
+
+	for _, arg := range args {
+		if opts.AbbrevRef {
+			name, err := abbrevRef(repoRoot, arg)
+			if err != nil {
+				return err
+			}
+			fmt.Println(name)
+			continue
+		}
+
+		if !opts.Verify && (strings.Contains(arg, "..") || strings.HasPrefix(arg, "^")) {
+			r, err := resolveRange(repoRoot, []string{arg})
+			if err != nil {
+				return err
+			}
+			for _, hash := range r.include {
+				fmt.Println(format(hash))
+			}
+			for _, hash := range r.exclude {
+				fmt.Println("^" + format(hash))
+			}
+			continue
+		}
+
+		hash, err := resolveRevision(repoRoot, arg)
+		if err != nil {
+			return err
+		}
+		fmt.Println(format(hash))
+	}
+	return nil
+}
+
+// abbrevRef returns the short ref name a revision refers to, such as
+// "main" for HEAD or "peer/main" for main@{u}.
+func abbrevRef(repoRoot, arg string) (string, error) {
+	base, suffix := splitRevision(arg)
+	if suffix != "" {
+		return "", fmt.Errorf("%s does not name a ref", arg)
+	}
+	if at := strings.Index(base, "@{"); at >= 0 {
+		if spec := strings.TrimSuffix(base[at+2:], "}"); spec != "u" && spec != "upstream" {
+			return "", fmt.Errorf("%s does not name a ref", arg)
+		}
+		branch := base[:at]
+		if branch == "" || branch == "HEAD" {
+			current, err := utils.CurrentBranch(repoRoot)
+			if err != nil {
+				return "", err
+			}
+			branch = current
+		}
+		if _, err := resolveUpstream(repoRoot, branch); err != nil {
+			return "", err
+		}
+		ref, err := upstreamRef(repoRoot, branch)
+		if err != nil {
+			return "", err
+		}
+		return shortRefName(ref), nil
+	}
+	if base == "HEAD" || base == "@" || base == "" {
+		ref, _, err := utils.ReadHead(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		if ref == "" {
+			return "HEAD", nil
+		}
+		return shortRefName(ref), nil
+	}
+	ref, err := lookupRef(repoRoot, base)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("%s does not name a ref", arg)
+	}
+	return shortRefName(strings.TrimPrefix(ref, utils.TagPrefix)), nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// TestSymmetricRangeCrissCross checks that A...B hides everything common to
+// both sides when a criss-cross merge leaves two merge bases: A merges Y
+// into X and B merges X into Y.
+//
+//	  X --- A - A2
+//	 /  \ /
+//	R    /
+//	 \  / \
+//	  Y --- B - B2
+func TestSymmetricRangeCrissCross(t *testing.T) {
+	_, repoRoot := initTestRepo(t)
+	tree, err := objects.NewStore(repoRoot).Put("tree", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string, parents ...string) string {
+		t.Helper()
+		hash, err := writeCommitObject(repoRoot, tree, parents, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	r := commit("R")
+	x := commit("X", r)
+	y := commit("Y", r)
+	a := commit("A", x, y)
+	b := commit("B", y, x)
+	a2 := commit("A2", a)
+	b2 := commit("B2", b)
+
+	bases, err := utils.MergeBases(repoRoot, a2, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bases) != 2 {
+		t.Fatalf("merge bases = %v, want X and Y", bases)
+	}
+
+	rng, err := resolveRange(repoRoot, []string{a2 + "..." + b2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden := map[string]bool{}
+	for _, h := range rng.exclude {
+		anc, err := utils.Ancestors(repoRoot, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for h := range anc {
+			hidden[h] = true
+		}
+	}
+	got := []string{}
+	for _, h := range rng.include {
+		anc, err := utils.Ancestors(repoRoot, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for h := range anc {
+			if !hidden[h] {
+				hidden[h] = true
+				got = append(got, h)
+			}
+		}
+	}
+	want := []string{a, a2, b, b2}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("A2...B2 selects %d commits, want 4 (A, A2, B, B2)", len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("A2...B2 selects %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/sammanbajracharya/drift_cli/internal/ignore"
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// hashWorkers bounds how many working files are hashed at once.
+var hashWorkers = runtime.GOMAXPROCS(0)
+
+// hashPaths hashes the working copies of paths on a bounded pool of
+// workers. Paths that no longer exist are left out of the result.
+func hashPaths(repoRoot string, paths []string) (map[string]string, error) {
+	type result struct {
+		path string
+		hash string
+		ok   bool
+		err  error
+	}
+
+	hashes := map[string]string{}
+	if len(paths) == 0 {
+		return hashes, nil
+	}
+
+	jobs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < min(hashWorkers, len(paths)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				hash, ok, err := worktreeHash(repoRoot, p)
+				results <- result{p, hash, ok, err}
+			}
+		}()
+	}
+	go func() {
+		for _, p := range paths {
+			jobs <- p
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	for r := range results {
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+		if r.ok {
+			hashes[r.path] = r.hash
+		}
+	}
+	return hashes, firstErr
+}
+
+// worktreeHashes returns the mode and blob id of the working copy of each
+// path that exists. Files whose stat data still matches their index entry
+// are not read at all. Entries that had to be hashed but turned out
+// unchanged are returned with fresh stat data so the caller can record it.
+func worktreeHashes(repoRoot string, idx *index.Index, paths []string) (map[string]utils.TreeEntry, []index.Entry, error) {
+	files := map[string]utils.TreeEntry{}
+	infos := map[string]os.FileInfo{}
+	toHash := []string{}
+	for _, p := range paths {
+		info, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat %s: %v", p, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		if e, ok := idx.Get(p); ok && e.Matches(info) && !idx.IsRacy(e) {
+			files[p] = utils.TreeEntry{Mode: e.Mode, Type: "blob", Hash: e.Hash, Name: p}
+			continue
+		}
+		infos[p] = info
+		toHash = append(toHash, p)
+	}
+
+	hashed, err := hashPaths(repoRoot, toHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh := []index.Entry{}
+	for p, hash := range hashed {
+		mode := index.FileMode(infos[p])
+		files[p] = utils.TreeEntry{Mode: mode, Type: "blob", Hash: hash, Name: p}
+		if e, ok := idx.Get(p); ok && e.Hash == hash && e.Mode == mode {
+			refresh = append(refresh, index.NewEntry(p, e.Mode, hash, infos[p]))
+		}
+	}
+	return files, refresh, nil
+}
+
+// refreshIndex records new stat data for entries whose content is
+// unchanged, so the next scan can skip them. It is best effort: if another
+// drift process holds the index lock the update is simply dropped.
+func refreshIndex(repoRoot string, entries []index.Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	index.Update(repoRoot, func(idx *index.Index) error {
+		for _, e := range entries {
+			if cur, ok := idx.Get(e.Path); ok && cur.Hash == e.Hash && cur.Mode == e.Mode {
+				idx.Add(e)
+			}
+		}
+		return nil
+	})
+}
+
+// worktreeScan is the difference between the working tree and the index.
+type worktreeScan struct {
+	modified  []string
+	deleted   []string
+	untracked []string
+}
+
+// scanWorktree walks the working tree and compares it with idx, skipping
+// ignored untracked files. Only tracked files whose stat data changed are
+// hashed.
+func scanWorktree(repoRoot string, idx *index.Index, matcher *ignore.Matcher) (*worktreeScan, error) {
+	tracked := trackedDirs(idx)
+	scan := &worktreeScan{}
+	present := []string{}
+
+	err := filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".drift" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(repoRoot, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %v", err)
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && !tracked[rel] && matcher.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := idx.Get(rel); ok {
+			present = append(present, rel)
+		} else if !matcher.Ignored(rel, false) {
+			scan.untracked = append(scan.untracked, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files, refresh, err := worktreeHashes(repoRoot, idx, present)
+	if err != nil {
+		return nil, err
+	}
+	refreshIndex(repoRoot, refresh)
+
+	for _, e := range idx.Entries() {
+		f, ok := files[e.Path]
+		switch {
+		case !ok:
+			scan.deleted = append(scan.deleted, e.Path)
+		case f.Hash != e.Hash || f.Mode != e.Mode:
+			scan.modified = append(scan.modified, e.Path)
+		}
+	}
+	sort.Strings(scan.untracked)
+	return scan, nil
+}
+
+// stageTracked stages the current content of every tracked file and the
+// removal of tracked files that are gone, as commit -a does. Untracked
+// files are left alone.
+func stageTracked(repoRoot string) error {
+	return index.Update(repoRoot, func(idx *index.Index) error {
+		entries := idx.Entries()
+		paths := make([]string, len(entries))
+		for i, e := range entries {
+			paths[i] = e.Path
+		}
+		files, _, err := worktreeHashes(repoRoot, idx, paths)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			f, ok := files[e.Path]
+			switch {
+			case !ok:
+				idx.Remove(e.Path)
+			case f.Hash != e.Hash || f.Mode != e.Mode:
+				if err := utils.AddFile(filepath.Join(repoRoot, filepath.FromSlash(e.Path)), repoRoot, idx); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
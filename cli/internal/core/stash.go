@@ -0,0 +1,482 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// stashRef holds the newest stash entry; its reflog is the stack, so
+// stash@{n} is the entry pushed n pushes ago.
+//
+// An entry is a commit W whose tree is the working tree of tracked files.
+// Its first parent is the HEAD it was made on, its second a commit I
+// holding the index, and, when untracked files were saved, its third a
+// parentless commit U holding those.
+const stashRef = "refs/stash"
+
+type StashPushOptions struct {
+	Message string
+	// IncludeUntracked saves untracked files as well, and removes them.
+	IncludeUntracked bool
+}
+
+type StashListOptions struct {
+	Color bool
+}
+
+type StashShowOptions struct {
+	Patch bool
+	Color bool
+}
+
+// writeCommitObject stores a commit made by the configured committer.
+func writeCommitObject(repoRoot, tree string, parents []string, msg string) (string, error) {
+	who, err := utils.ResolveIdentity(repoRoot, utils.RoleCommitter)
+	if err != nil {
+		return "", err
+	}
+	var content strings.Builder
+	fmt.Fprintf(&content, "tree %s\n", tree)
+	for _, p := range parents {
+		fmt.Fprintf(&content, "parent %s\n", p)
+	}
+	fmt.Fprintf(&content, "author %s\n", who)
+	fmt.Fprintf(&content, "committer %s\n", who)
+	fmt.Fprintf(&content, "\n%s\n", msg)
+	hash, err := objects.NewStore(repoRoot).Put("commit", []byte(content.String()))
+	if err != nil {
+		return "", fmt.Errorf("failed to write commit object: %v", err)
+	}
+	return hash, nil
+}
+
+// stashEntries returns the stash stack, newest first.
+func stashEntries(repoRoot string) ([]utils.ReflogEntry, error) {
+	entries, err := utils.ReadReflog(repoRoot, stashRef)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// parseStashName accepts "", "stash@{n}" or "n" and returns n.
+func parseStashName(name string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+	n := strings.TrimSuffix(strings.TrimPrefix(name, "stash@{"), "}")
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 || (n != name && name != "stash@{"+n+"}") {
+		return 0, fmt.Errorf("%s is not a valid stash reference", name)
+	}
+	return i, nil
+}
+
+// lookupStash returns the position and commit of the named stash entry.
+func lookupStash(repoRoot, name string) (int, utils.ReflogEntry, error) {
+	n, err := parseStashName(name)
+	if err != nil {
+		return 0, utils.ReflogEntry{}, err
+	}
+	entries, err := stashEntries(repoRoot)
+	if err != nil {
+		return 0, utils.ReflogEntry{}, err
+	}
+	if len(entries) == 0 {
+		return 0, utils.ReflogEntry{}, fmt.Errorf("no stash entries found")
+	}
+	if n >= len(entries) {
+		return 0, utils.ReflogEntry{}, fmt.Errorf("stash@{%d} does not exist; there are only %d stash entries", n, len(entries))
+	}
+	return n, entries[n], nil
+}
+
+// StashPush saves the staged and unstaged changes, and with
+// opts.IncludeUntracked the untracked files, as a new stash entry, then
+// resets the index and working tree to HEAD.
+func (c *Context) StashPush(opts StashPushOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if state, err := readMergeState(repoRoot); err != nil {
+		return err
+	} else if state != nil {
+		return fmt.Errorf("cannot stash during a merge; finish it with 'drift merge --continue' or 'drift merge --abort'")
+	}
+
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	if head == "" {
+		return fmt.Errorf("you do not have the initial commit yet")
+	}
+	headCommit, err := utils.ReadCommit(repoRoot, head)
+	if err != nil {
+		return err
+	}
+
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		return err
+	}
+	matcher, err := newIgnoreMatcher(repoRoot)
+	if err != nil {
+		return err
+	}
+	scan, err := scanWorktree(repoRoot, idx, matcher)
+	if err != nil {
+		return err
+	}
+	indexTree, err := utils.BuildTree(utils.IndexTreeEntries(idx), repoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to build tree: %v", err)
+	}
+
+	// The working tree commit is the index with every tracked file's
+	// current content staged on top.
+	work, err := index.Read(repoRoot)
+	if err != nil {
+		return err
+	}
+	for _, p := range scan.modified {
+		if err := utils.AddFile(filepath.Join(repoRoot, filepath.FromSlash(p)), repoRoot, work); err != nil {
+			return err
+		}
+	}
+	for _, p := range scan.deleted {
+		work.Remove(p)
+	}
+	workTree, err := utils.BuildTree(utils.IndexTreeEntries(work), repoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to build tree: %v", err)
+	}
+
+	untracked := []string{}
+	if opts.IncludeUntracked {
+		untracked = scan.untracked
+	}
+	if indexTree == headCommit.Tree && workTree == headCommit.Tree && len(untracked) == 0 {
+		fmt.Println("No local changes to save")
+		return nil
+	}
+
+	branch, err := headName(repoRoot)
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(headCommit.Message, "\n")
+	on := fmt.Sprintf("%s: %s %s", branch, head[:7], subject)
+
+	indexCommit, err := writeCommitObject(repoRoot, indexTree, []string{head}, "index on "+on)
+	if err != nil {
+		return err
+	}
+	parents := []string{head, indexCommit}
+	if len(untracked) > 0 {
+		saved := index.New()
+		for _, p := range untracked {
+			if err := utils.AddFile(filepath.Join(repoRoot, filepath.FromSlash(p)), repoRoot, saved); err != nil {
+				return err
+			}
+		}
+		untrackedTree, err := utils.BuildTree(utils.IndexTreeEntries(saved), repoRoot)
+		if err != nil {
+			return fmt.Errorf("failed to build tree: %v", err)
+		}
+		untrackedCommit, err := writeCommitObject(repoRoot, untrackedTree, nil, "untracked files on "+on)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+
+	msg := "WIP on " + on
+	if opts.Message != "" {
+		msg = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+	stash, err := writeCommitObject(repoRoot, workTree, parents, msg)
+	if err != nil {
+		return err
+	}
+	old, err := refs.Read(repoRoot, stashRef)
+	if err != nil {
+		return err
+	}
+	if err := writeRef(repoRoot, stashRef, stash, old, msg); err != nil {
+		return err
+	}
+
+	// The changes are safe in the stash; go back to a clean HEAD.
+	changed := append(append([]string{}, scan.modified...), scan.deleted...)
+	if err := resetPaths(repoRoot, head, changed); err != nil {
+		return err
+	}
+	for _, p := range untracked {
+		if err := removeWorktreeFile(repoRoot, p); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Saved working directory and index state %s\n", msg)
+	return nil
+}
+
+// resetPaths returns the given paths, and every path staged differently
+// from commit, to their state in commit, in both the index and the working
+// tree.
+func resetPaths(repoRoot, commit string, paths []string) error {
+	files, err := commitFiles(repoRoot, commit)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+	return index.Update(repoRoot, func(idx *index.Index) error {
+		reset := map[string]bool{}
+		for _, p := range paths {
+			reset[p] = true
+		}
+		for _, e := range idx.Entries() {
+			if f, ok := files[e.Path]; !ok || f.Hash != e.Hash || f.Mode != e.Mode {
+				reset[e.Path] = true
+			}
+		}
+		for p := range files {
+			if _, ok := idx.Get(p); !ok {
+				reset[p] = true
+			}
+		}
+
+		for p := range reset {
+			f, ok := files[p]
+			if !ok {
+				if err := removeWorktreeFile(repoRoot, p); err != nil {
+					return err
+				}
+				idx.Remove(p)
+				continue
+			}
+			f.Name = p
+			entry, err := writeWorktreeFile(repoRoot, store, f)
+			if err != nil {
+				return err
+			}
+			idx.Add(entry)
+		}
+		return nil
+	})
+}
+
+// StashApply reapplies a stash entry on top of the current HEAD. Changes
+// are merged three ways against the commit the entry was made on; a path
+// that cannot be merged gets conflict markers and the entry is kept.
+// With drop, the entry is removed once it applied cleanly.
+func (c *Context) StashApply(name string, drop bool) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if state, err := readMergeState(repoRoot); err != nil {
+		return err
+	} else if state != nil {
+		return fmt.Errorf("cannot apply a stash during a merge; finish it with 'drift merge --continue' or 'drift merge --abort'")
+	}
+	n, entry, err := lookupStash(repoRoot, name)
+	if err != nil {
+		return err
+	}
+	label := fmt.Sprintf("stash@{%d}", n)
+	stash, err := utils.ReadCommit(repoRoot, entry.New)
+	if err != nil {
+		return err
+	}
+	if len(stash.Parents) < 2 {
+		return fmt.Errorf("%s is not a stash commit", label)
+	}
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	headFiles, err := commitFiles(repoRoot, head)
+	if err != nil {
+		return err
+	}
+
+	// Untracked files come back as they were, so nothing may be in their
+	// way.
+	var untracked map[string]utils.TreeEntry
+	if len(stash.Parents) > 2 {
+		if untracked, err = commitFiles(repoRoot, stash.Parents[2]); err != nil {
+			return err
+		}
+		for p := range untracked {
+			if _, err := os.Lstat(filepath.Join(repoRoot, filepath.FromSlash(p))); err == nil {
+				return fmt.Errorf("%s already exists, no checkout\ncould not restore untracked files from stash", p)
+			}
+		}
+	}
+
+	conflicts, err := mergeTrees(repoRoot, stash.Parents[0], head, stash.Hash, label, "stash apply")
+	if err != nil {
+		return err
+	}
+
+	store := objects.NewStore(repoRoot)
+	err = index.Update(repoRoot, func(idx *index.Index) error {
+		// Like git, leave the restored changes unstaged, except for files
+		// the stash adds, which stay staged so they are not lost.
+		for _, e := range idx.Entries() {
+			if h, ok := headFiles[e.Path]; ok && (h.Hash != e.Hash || h.Mode != e.Mode) {
+				idx.Add(index.Entry{Path: e.Path, Mode: h.Mode, Hash: h.Hash})
+			}
+		}
+		for p, h := range headFiles {
+			if _, ok := idx.Get(p); !ok {
+				idx.Add(index.Entry{Path: p, Mode: h.Mode, Hash: h.Hash})
+			}
+		}
+		for p, e := range untracked {
+			e.Name = p
+			if _, err := writeWorktreeFile(repoRoot, store, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("fix the conflicts in the files above and 'drift add' them\nThe stash entry is kept in case you need it again.")
+	}
+	if drop {
+		return dropStash(repoRoot, n, entry)
+	}
+	return nil
+}
+
+// StashDrop removes a stash entry.
+func (c *Context) StashDrop(name string) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	n, entry, err := lookupStash(repoRoot, name)
+	if err != nil {
+		return err
+	}
+	return dropStash(repoRoot, n, entry)
+}
+
+// dropStash removes entry n from the stash reflog, moving refs/stash to
+// the next entry when the newest is dropped and deleting it with the last.
+func dropStash(repoRoot string, n int, entry utils.ReflogEntry) error {
+	entries, err := stashEntries(repoRoot)
+	if err != nil {
+		return err
+	}
+	current, err := refs.Read(repoRoot, stashRef)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 1 {
+		if err := deleteRef(repoRoot, stashRef, current); err != nil {
+			return err
+		}
+	} else {
+		if n == 0 {
+			if err := refs.Update(repoRoot, stashRef, entries[1].New, current); err != nil {
+				return err
+			}
+		}
+		kept := make([]utils.ReflogEntry, 0, len(entries)-1)
+		for i := len(entries) - 1; i >= 0; i-- {
+			if i != n {
+				kept = append(kept, entries[i])
+			}
+		}
+		if err := utils.WriteReflog(repoRoot, stashRef, kept); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Dropped stash@{%d} (%s)\n", n, entry.New[:7])
+	return nil
+}
+
+// StashList prints the stash entries, newest first.
+func (c *Context) StashList(opts StashListOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	entries, err := stashEntries(repoRoot)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		fmt.Printf("%s: %s\n", colorize(opts.Color, "33", fmt.Sprintf("stash@{%d}", i)), e.Message)
+	}
+	return nil
+}
+
+// StashShow prints the changes a stash entry records against the commit
+// it was made on, as a diffstat or, with opts.Patch, as a patch.
+func (c *Context) StashShow(name string, opts StashShowOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	_, entry, err := lookupStash(repoRoot, name)
+	if err != nil {
+		return err
+	}
+	stash, err := utils.ReadCommit(repoRoot, entry.New)
+	if err != nil {
+		return err
+	}
+	if len(stash.Parents) == 0 {
+		return fmt.Errorf("%s is not a stash commit", entry.New)
+	}
+	return c.Diff(DiffOptions{
+		Revs:  []string{stash.Parents[0], stash.Hash},
+		Stat:  !opts.Patch,
+		Color: opts.Color,
+	})
+}
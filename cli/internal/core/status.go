@@ -0,0 +1,292 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type StatusOptions struct {
+	// Short prints one "XY path" line per changed path.
+	Short bool
+	// Porcelain is Short without colors, for scripts. Its format will not
+	// change between versions.
+	Porcelain bool
+	// Branch adds a "## branch...upstream" header to the short formats.
+	Branch bool
+	// Color paints paths by state. Porcelain output is never colored.
+	Color bool
+}
+
+// fileStatus is the state of one path: X compares the index with HEAD and
+// Y the working tree with the index, using the letters of the short format
+// (' ' unchanged, 'A' added, 'M' modified, 'D' deleted, 'U' unmerged,
+// '?' untracked).
+type fileStatus struct {
+	path string
+	x, y byte
+}
+
+// collectStatus compares HEAD, the index and the working tree.
+func collectStatus(repoRoot, head string) ([]fileStatus, error) {
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	headFiles, err := commitFiles(repoRoot, head)
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := newIgnoreMatcher(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	scan, err := scanWorktree(repoRoot, idx, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]*fileStatus{}
+	get := func(p string) *fileStatus {
+		if st, ok := states[p]; ok {
+			return st
+		}
+		st := &fileStatus{path: p, x: ' ', y: ' '}
+		states[p] = st
+		return st
+	}
+
+	for _, e := range idx.Entries() {
+		h, ok := headFiles[e.Path]
+		switch {
+		case !ok:
+			get(e.Path).x = 'A'
+		case h.Hash != e.Hash || h.Mode != e.Mode:
+			get(e.Path).x = 'M'
+		}
+	}
+	for p := range headFiles {
+		if _, ok := idx.Get(p); !ok {
+			get(p).x = 'D'
+		}
+	}
+	for _, p := range scan.modified {
+		get(p).y = 'M'
+	}
+	for _, p := range scan.deleted {
+		get(p).y = 'D'
+	}
+
+	merge, err := readMergeState(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	unmerged := map[string]bool{}
+	if merge != nil {
+		unresolved, err := unresolvedConflicts(repoRoot, idx, merge.Conflicts)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range unresolved {
+			unmerged[p] = true
+			st := get(p)
+			st.x, st.y = 'U', 'U'
+		}
+	}
+
+	list := make([]fileStatus, 0, len(states)+len(scan.untracked))
+	for _, st := range states {
+		list = append(list, *st)
+	}
+	// An untracked file can sit where a staged deletion was, so untracked
+	// paths get their own entries.
+	for _, p := range scan.untracked {
+		if !unmerged[p] {
+			list = append(list, fileStatus{path: p, x: '?', y: '?'})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].path < list[j].path })
+	return list, nil
+}
+
+func (c *Context) Status(opts StatusOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	repoRoot, err := utils.FindDriftRoot(cwd)
+	if err != nil {
+		return fmt.Errorf("failed to find Drift repository root: %v", err)
+	}
+
+	headRef, headHash, err := utils.ReadHead(repoRoot)
+	if err != nil {
+		return err
+	}
+	branchName := strings.TrimPrefix(headRef, utils.BranchPrefix)
+
+	states, err := collectStatus(repoRoot, headHash)
+	if err != nil {
+		return err
+	}
+
+	if opts.Short || opts.Porcelain {
+		return printShortStatus(repoRoot, branchName, headHash, states, opts)
+	}
+
+	if branchName == "" {
+		fmt.Printf("HEAD detached at %s\n", headHash[:7])
+	} else {
+		fmt.Printf("On branch %s\n", branchName)
+		if err := printTrackingInfo(repoRoot, branchName, headHash); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	if headHash == "" {
+		fmt.Println("No commits yet")
+		fmt.Println()
+	}
+
+	merge, err := readMergeState(repoRoot)
+	if err != nil {
+		return err
+	}
+
+	var staged, unmerged, unstaged, untracked []fileStatus
+	for _, st := range states {
+		switch {
+		case st.x == 'U':
+			unmerged = append(unmerged, st)
+		case st.x == '?':
+			untracked = append(untracked, st)
+		default:
+			if st.x != ' ' {
+				staged = append(staged, st)
+			}
+			if st.y != ' ' {
+				unstaged = append(unstaged, st)
+			}
+		}
+	}
+
+	if merge != nil {
+		if len(unmerged) > 0 {
+			fmt.Println("You have unmerged paths.")
+			fmt.Println(`  (fix conflicts and run "drift commit")`)
+		} else {
+			fmt.Println("All conflicts fixed but you are still merging.")
+			fmt.Println(`  (use "drift commit" to conclude merge)`)
+		}
+		fmt.Println(`  (use "drift merge --abort" to abort the merge)`)
+		fmt.Println()
+	}
+
+	stagedLabels := map[byte]string{'A': "new file:   ", 'M': "modified:   ", 'D': "deleted:    "}
+	if len(staged) > 0 {
+		fmt.Println("Changes to be committed:")
+		fmt.Println(`  (use "drift restore --staged <file>..." to unstage)`)
+		for _, st := range staged {
+			fmt.Printf("        %s\n", colorize(opts.Color, "32", stagedLabels[st.x]+st.path))
+		}
+		fmt.Println()
+	}
+
+	if len(unmerged) > 0 {
+		fmt.Println("Unmerged paths:")
+		fmt.Println(`  (use "drift add <file>..." to mark resolution)`)
+		for _, st := range unmerged {
+			fmt.Printf("        %s\n", colorize(opts.Color, "31", "both modified:   "+st.path))
+		}
+		fmt.Println()
+	}
+
+	if len(unstaged) > 0 {
+		fmt.Println("Changes not staged for commit:")
+		fmt.Println(`  (use "drift add/rm <file>..." to update what will be committed)`)
+		fmt.Println(`  (use "drift restore <file>..." to discard changes in working directory)`)
+		for _, st := range unstaged {
+			if st.y == 'D' {
+				fmt.Printf("        %s\n", colorize(opts.Color, "31", "deleted:    "+st.path))
+			} else {
+				fmt.Printf("        %s\n", colorize(opts.Color, "34", "modified:   "+st.path))
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(untracked) > 0 {
+		fmt.Println("Untracked files:")
+		fmt.Println(`  (use "drift add <file>..." to include in what will be committed)`)
+		for _, st := range untracked {
+			fmt.Printf("        %s\n", colorize(opts.Color, "31", st.path))
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case len(staged) > 0 || merge != nil:
+	case len(unstaged) > 0:
+		fmt.Println(`no changes added to commit (use "drift add" and/or "drift commit -a")`)
+	case len(untracked) > 0:
+		fmt.Println(`nothing added to commit but untracked files present (use "drift add" to track)`)
+	default:
+		fmt.Println("nothing to commit, working tree clean")
+	}
+	return nil
+}
+
+// printShortStatus prints the --short and --porcelain formats.
+func printShortStatus(repoRoot, branch, head string, states []fileStatus, opts StatusOptions) error {
+	color := opts.Color && !opts.Porcelain
+	paint := func(code string, b byte) string {
+		return colorize(color && b != ' ', code, string(b))
+	}
+
+	if opts.Branch {
+		switch {
+		case branch == "":
+			fmt.Println("## HEAD (no branch)")
+		case head == "":
+			fmt.Printf("## No commits yet on %s\n", branch)
+		default:
+			line := "## " + branch
+			t, err := trackingInfo(repoRoot, branch, head)
+			if err != nil {
+				return err
+			}
+			if t != nil {
+				line += "..." + t.name
+				switch {
+				case t.gone:
+					line += " [gone]"
+				case t.ahead > 0 && t.behind > 0:
+					line += fmt.Sprintf(" [ahead %d, behind %d]", t.ahead, t.behind)
+				case t.ahead > 0:
+					line += fmt.Sprintf(" [ahead %d]", t.ahead)
+				case t.behind > 0:
+					line += fmt.Sprintf(" [behind %d]", t.behind)
+				}
+			}
+			fmt.Println(line)
+		}
+	}
+
+	for _, st := range states {
+		if st.x == '?' || st.x == 'U' {
+			fmt.Printf("%s%s %s\n", paint("31", st.x), paint("31", st.y), st.path)
+			continue
+		}
+		fmt.Printf("%s%s %s\n", paint("32", st.x), paint("31", st.y), st.path)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+)
+
+const benchStatusFiles = 100_000
+
+// setupStatusTree writes n small files in 100 directories and an index
+// that tracks them without stat data, as after a fresh clone.
+func setupStatusTree(b *testing.B, n int) (string, []index.Entry) {
+	b.Helper()
+	repoRoot := b.TempDir()
+	b.Setenv("HOME", b.TempDir())
+	if err := os.MkdirAll(filepath.Join(repoRoot, ".drift"), 0755); err != nil {
+		b.Fatal(err)
+	}
+
+	entries := make([]index.Entry, 0, n)
+	for i := 0; i < n; i++ {
+		rel := fmt.Sprintf("dir%02d/file%06d.txt", i%100, i)
+		content := []byte(fmt.Sprintf("file %d\n", i))
+		full := filepath.Join(repoRoot, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(full, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+		entries = append(entries, index.Entry{Path: rel, Mode: index.ModeFile, Hash: objects.Hash("blob", content)})
+	}
+	return repoRoot, entries
+}
+
+func writeStatlessIndex(b *testing.B, repoRoot string, entries []index.Entry) {
+	b.Helper()
+	err := index.Update(repoRoot, func(idx *index.Index) error {
+		for _, e := range entries {
+			idx.Add(e)
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// hashedFiles returns how many tracked files a scan would have to read.
+func hashedFiles(b *testing.B, repoRoot string) int {
+	b.Helper()
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		b.Fatal(err)
+	}
+	paths := []string{}
+	for _, e := range idx.Entries() {
+		paths = append(paths, e.Path)
+	}
+	// Nothing in the tree changes, so every file that gets hashed comes
+	// back as an entry to refresh.
+	_, refresh, err := worktreeHashes(repoRoot, idx, paths)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return len(refresh)
+}
+
+func scanOnce(b *testing.B, repoRoot string) {
+	b.Helper()
+	idx, err := index.Read(repoRoot)
+	if err != nil {
+		b.Fatal(err)
+	}
+	matcher, err := newIgnoreMatcher(repoRoot)
+	if err != nil {
+		b.Fatal(err)
+	}
+	scan, err := scanWorktree(repoRoot, idx, matcher)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(scan.modified)+len(scan.deleted)+len(scan.untracked) != 0 {
+		b.Fatalf("clean tree reported changes: %+v", scan)
+	}
+}
+
+// BenchmarkStatus scans a 100k-file tree cold, with an index that has no
+// stat data so every file is hashed, and warm, where the stat cache lets
+// the scan skip reading files entirely.
+func BenchmarkStatus(b *testing.B) {
+	repoRoot, entries := setupStatusTree(b, benchStatusFiles)
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			writeStatlessIndex(b, repoRoot, entries)
+			if n := hashedFiles(b, repoRoot); n != benchStatusFiles {
+				b.Fatalf("cold scan would hash %d files, want %d", n, benchStatusFiles)
+			}
+			b.StartTimer()
+			scanOnce(b, repoRoot)
+		}
+		b.ReportMetric(benchStatusFiles, "hashed/op")
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		writeStatlessIndex(b, repoRoot, entries)
+		// The first scan records stat data for every file.
+		scanOnce(b, repoRoot)
+		if n := hashedFiles(b, repoRoot); n != 0 {
+			b.Fatalf("warm scan would hash %d files, want 0", n)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			scanOnce(b, repoRoot)
+		}
+		b.StopTimer()
+		if n := hashedFiles(b, repoRoot); n != 0 {
+			b.Fatalf("warm scan hashed %d files, want 0", n)
+		}
+		b.ReportMetric(0, "hashed/op")
+	})
+}
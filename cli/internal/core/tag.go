@@ -0,0 +1,227 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type TagOptions struct {
+	// Message makes the tag annotated.
+	Message   string
+	Annotated bool
+	Force     bool
+}
+
+type DescribeOptions struct {
+	// Tags also considers lightweight tags, not only annotated ones.
+	Tags bool
+	// Always falls back to the abbreviated commit id when no tag is found.
+	Always bool
+}
+
+// ListTags prints tag names matching any of patterns, or every tag when no
+// pattern is given.
+func (c *Context) ListTags(patterns []string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+
+	tags, err := refs.List(repoRoot, utils.TagPrefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range tags {
+		matched := len(patterns) == 0
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
+
+// CreateTag points refs/tags/<name> at target (HEAD when ""). With a
+// message it first writes an annotated tag object recording the tagger.
+func (c *Context) CreateTag(name, target string, opts TagOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := utils.CheckRefName(name); err != nil {
+		return err
+	}
+	if opts.Annotated && opts.Message == "" {
+		return fmt.Errorf("an annotated tag needs a message; use -m <message>")
+	}
+
+	ref := utils.TagPrefix + name
+	existing, err := refs.Read(repoRoot, ref)
+	if err != nil {
+		return err
+	}
+	if existing != "" && !opts.Force {
+		return fmt.Errorf("tag '%s' already exists", name)
+	}
+
+	hash, err := resolveRevision(repoRoot, target)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+	r, err := store.Open(hash)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid object: %v", target, err)
+	}
+	objType := r.Type
+	r.Close()
+
+	if opts.Message != "" {
+		tagger, err := utils.ResolveIdentity(repoRoot, utils.RoleCommitter)
+		if err != nil {
+			return err
+		}
+		tag := &utils.TagObject{
+			Object:  hash,
+			Type:    objType,
+			Name:    name,
+			Tagger:  tagger,
+			Message: strings.TrimRight(opts.Message, "\n"),
+		}
+		if hash, err = store.Put("tag", tag.Bytes()); err != nil {
+			return fmt.Errorf("failed to write tag object: %v", err)
+		}
+	}
+
+	if err := writeRef(repoRoot, ref, hash, existing, "tag: tagging "+orHead(target)); err != nil {
+		return err
+	}
+	if existing != "" && existing != hash {
+		fmt.Printf("Updated tag '%s' (was %s)\n", name, existing[:7])
+	}
+	return nil
+}
+
+func (c *Context) DeleteTag(name string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	ref := utils.TagPrefix + name
+	hash, err := refs.Read(repoRoot, ref)
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		return fmt.Errorf("tag '%s' not found", name)
+	}
+	if err := deleteRef(repoRoot, ref, hash); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted tag '%s' (was %s)\n", name, hash[:7])
+	return nil
+}
+
+// Describe names a commit after the nearest tag it descends from:
+// "<tag>" when the commit is tagged, otherwise
+// "<tag>-<commits since tag>-g<abbreviated id>".
+func (c *Context) Describe(rev string, opts DescribeOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	target, err := resolveCommit(repoRoot, rev)
+	if err != nil {
+		return err
+	}
+
+	// Map each tagged commit to its tag names, annotated tags first.
+	tagNames, err := refs.List(repoRoot, utils.TagPrefix)
+	if err != nil {
+		return err
+	}
+	tagged := map[string][]string{}
+	for _, name := range tagNames {
+		hash, err := refs.Read(repoRoot, utils.TagPrefix+name)
+		if err != nil {
+			return err
+		}
+		peeled, objType, err := utils.PeelTag(repoRoot, hash)
+		if err != nil || objType != "commit" {
+			continue
+		}
+		annotated := peeled != hash
+		switch {
+		case annotated:
+			tagged[peeled] = append([]string{name}, tagged[peeled]...)
+		case opts.Tags:
+			tagged[peeled] = append(tagged[peeled], name)
+		}
+	}
+
+	// Breadth-first from the target finds the tag with the fewest
+	// parent steps in between.
+	queue := []string{target}
+	seen := map[string]bool{target: true}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if names := tagged[hash]; len(names) > 0 {
+			if hash == target {
+				fmt.Println(names[0])
+				return nil
+			}
+			ahead, _, err := utils.AheadBehind(repoRoot, target, hash)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s-%d-g%s\n", names[0], ahead, target[:7])
+			return nil
+		}
+		commit, err := utils.ReadCommit(repoRoot, hash)
+		if err != nil {
+			return err
+		}
+		for _, p := range commit.Parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	if opts.Always {
+		fmt.Println(target[:7])
+		return nil
+	}
+	if len(tagNames) > 0 && !opts.Tags {
+		return fmt.Errorf("no annotated tags can describe '%s'; try --tags", target)
+	}
+	return fmt.Errorf("no names found, cannot describe anything")
+}
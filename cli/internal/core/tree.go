@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+var fullHashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// resolveTreeish returns the tree for a commit-ish or tree-ish name.
+func resolveTreeish(repoRoot, name string) (string, error) {
+	hash, err := resolveRevision(repoRoot, name)
+	if err != nil {
+		return "", err
+	}
+	hash, _, err = utils.PeelTag(repoRoot, hash)
+	if err != nil {
+		return "", err
+	}
+	objType, data, err := objects.NewStore(repoRoot).Get(hash)
+	if err != nil {
+		return "", err
+	}
+	switch objType {
+	case "tree":
+		return hash, nil
+	case "commit":
+		commit, err := utils.ParseCommit(hash, data)
+		if err != nil {
+			return "", err
+		}
+		return commit.Tree, nil
+	default:
+		return "", fmt.Errorf("%s is a %s, not a tree-ish", name, objType)
+	}
+}
+
+func (c *Context) LsTree(treeish string, recursive bool) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	treeHash, err := resolveTreeish(repoRoot, treeish)
+	if err != nil {
+		return err
+	}
+
+	var list func(hash, prefix string) error
+	list = func(hash, prefix string) error {
+		entries, err := utils.ReadTree(repoRoot, hash)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if recursive && e.Type == "tree" {
+				if err := list(e.Hash, prefix+e.Name+"/"); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s %s %s\t%s\n", e.Mode, e.Type, e.Hash, prefix+e.Name)
+		}
+		return nil
+	}
+	return list(treeHash, "")
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+type UpdateRefOptions struct {
+	// Delete removes the ref instead of moving it.
+	Delete bool
+	// Message is recorded in the ref's reflog.
+	Message string
+}
+
+// UpdateRef points ref at the object newValue resolves to, or deletes it.
+// When oldValue is given the ref must still hold it, and a zero id means
+// the ref must not exist yet. This is how remote-tracking branches under
+// refs/remotes/<peer>/ are recorded when commits arrive from a peer.
+func (c *Context) UpdateRef(ref, newValue, oldValue string, opts UpdateRefOptions) error {
+	if err := utils.CheckInitialized(); err != nil {
+		return err
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	lock, err := lockRepo(repoRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if !strings.HasPrefix(ref, "refs/") {
+		return fmt.Errorf("cannot update ref '%s': only refs under refs/ can be updated", ref)
+	}
+	if err := utils.CheckRefName(ref); err != nil {
+		return err
+	}
+
+	current, err := refs.Read(repoRoot, ref)
+	if err != nil {
+		return err
+	}
+	old := current
+	if oldValue != "" {
+		if old, err = resolveOldValue(repoRoot, oldValue); err != nil {
+			return err
+		}
+	}
+
+	if opts.Delete {
+		if current == "" && oldValue == "" {
+			return fmt.Errorf("cannot delete ref '%s': it does not exist", ref)
+		}
+		return deleteRef(repoRoot, ref, old)
+	}
+
+	hash, err := resolveRevision(repoRoot, newValue)
+	if err != nil {
+		return err
+	}
+	// Branches, local or remote-tracking, always name commits.
+	if strings.HasPrefix(ref, utils.BranchPrefix) || strings.HasPrefix(ref, utils.RemotePrefix) {
+		if hash, err = resolveCommit(repoRoot, hash); err != nil {
+			return err
+		}
+	}
+	reason := opts.Message
+	if reason == "" {
+		reason = "update-ref"
+	}
+	return writeRef(repoRoot, ref, hash, old, reason)
+}
+
+// resolveOldValue resolves the value a ref is expected to hold, where the
+// zero id stands for a ref that does not exist.
+func resolveOldValue(repoRoot, value string) (string, error) {
+	if value == utils.ZeroHash {
+		return "", nil
+	}
+	return resolveRevision(repoRoot, value)
+}
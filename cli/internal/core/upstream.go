@@ -0,0 +1,225 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+	"gopkg.in/ini.v1"
+)
+
+// A branch's upstream is stored in the repository config as
+//
+//	[branch "main"]
+//	remote = <peer>
+//	merge = refs/heads/main
+//
+// which tracks refs/remotes/<peer>/main. A remote of "." means the
+// upstream is the local branch named by merge.
+
+func branchSection(name string) string {
+	return fmt.Sprintf("branch %q", name)
+}
+
+func repoConfigPath(repoRoot string) string {
+	return filepath.Join(repoRoot, ".drift", "config")
+}
+
+// upstreamRef returns the full ref the branch tracks, or "" when no
+// upstream is configured.
+func upstreamRef(repoRoot, branch string) (string, error) {
+	cfg, err := ini.LooseLoad(repoConfigPath(repoRoot))
+	if err != nil {
+		return "", fmt.Errorf("error loading config: %v", err)
+	}
+	if !cfg.HasSection(branchSection(branch)) {
+		return "", nil
+	}
+	section := cfg.Section(branchSection(branch))
+	remote := section.Key("remote").String()
+	merge := section.Key("merge").String()
+	if remote == "" || !strings.HasPrefix(merge, utils.BranchPrefix) {
+		return "", nil
+	}
+	if remote == "." {
+		return merge, nil
+	}
+	return utils.RemotePrefix + remote + "/" + strings.TrimPrefix(merge, utils.BranchPrefix), nil
+}
+
+// shortRefName strips the refs/heads/ or refs/remotes/ prefix for display.
+func shortRefName(ref string) string {
+	for _, prefix := range []string{utils.BranchPrefix, utils.RemotePrefix} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
+// updateBranchConfig moves (newName != "") or drops the upstream settings
+// of a branch that is being renamed or deleted.
+func updateBranchConfig(repoRoot, oldName, newName string) error {
+	path := repoConfigPath(repoRoot)
+	cfg, err := ini.LooseLoad(path)
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	if !cfg.HasSection(branchSection(oldName)) {
+		return nil
+	}
+	if newName != "" {
+		old := cfg.Section(branchSection(oldName))
+		renamed := cfg.Section(branchSection(newName))
+		for _, key := range old.Keys() {
+			renamed.Key(key.Name()).SetValue(key.Value())
+		}
+	}
+	cfg.DeleteSection(branchSection(oldName))
+	if err := cfg.SaveTo(path); err != nil {
+		return fmt.Errorf("error saving config: %v", err)
+	}
+	return nil
+}
+
+// SetUpstream makes branch (the current branch when "") track upstream,
+// which is either "<peer>/<branch>" naming a remote-tracking branch or the
+// name of a local branch.
+func (c *Context) SetUpstream(branch, upstream string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		if branch, err = utils.CurrentBranch(repoRoot); err != nil {
+			return err
+		}
+		if branch == "" {
+			return fmt.Errorf("HEAD is detached; name the branch whose upstream to set")
+		}
+	}
+	if !branchExists(repoRoot, branch) {
+		return fmt.Errorf("branch '%s' does not exist", branch)
+	}
+
+	var remote, merge string
+	switch {
+	case branchExists(repoRoot, upstream):
+		remote, merge = ".", utils.BranchPrefix+upstream
+	default:
+		hash, err := refs.Read(repoRoot, utils.RemotePrefix+upstream)
+		if err != nil {
+			return err
+		}
+		peer, name, ok := strings.Cut(upstream, "/")
+		if hash == "" || !ok {
+			return fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+		}
+		remote, merge = peer, utils.BranchPrefix+name
+	}
+	if remote == "." && strings.TrimPrefix(merge, utils.BranchPrefix) == branch {
+		return fmt.Errorf("branch '%s' cannot be its own upstream", branch)
+	}
+
+	path := repoConfigPath(repoRoot)
+	cfg, err := ini.LooseLoad(path)
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	section := cfg.Section(branchSection(branch))
+	section.Key("remote").SetValue(remote)
+	section.Key("merge").SetValue(merge)
+	if err := cfg.SaveTo(path); err != nil {
+		return fmt.Errorf("error saving config: %v", err)
+	}
+
+	fmt.Printf("branch '%s' set up to track '%s'.\n", branch, upstream)
+	return nil
+}
+
+// UnsetUpstream removes the upstream of branch (the current branch when "").
+func (c *Context) UnsetUpstream(branch string) error {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		if branch, err = utils.CurrentBranch(repoRoot); err != nil {
+			return err
+		}
+	}
+	ref, err := upstreamRef(repoRoot, branch)
+	if err != nil {
+		return err
+	}
+	if ref == "" {
+		return fmt.Errorf("branch '%s' has no upstream information", branch)
+	}
+	return updateBranchConfig(repoRoot, branch, "")
+}
+
+// tracking describes a branch's relation to its upstream.
+type tracking struct {
+	name   string
+	gone   bool
+	ahead  int
+	behind int
+}
+
+// trackingInfo compares branch with its upstream. It returns nil when no
+// upstream is configured.
+func trackingInfo(repoRoot, branch, head string) (*tracking, error) {
+	ref, err := upstreamRef(repoRoot, branch)
+	if err != nil || ref == "" {
+		return nil, err
+	}
+	t := &tracking{name: shortRefName(ref)}
+	upstream, err := refs.Read(repoRoot, ref)
+	if err != nil {
+		return nil, err
+	}
+	if upstream == "" {
+		t.gone = true
+		return t, nil
+	}
+	t.ahead, t.behind, err = utils.AheadBehind(repoRoot, head, upstream)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// printTrackingInfo prints how branch relates to its upstream, or nothing
+// when it has none.
+func printTrackingInfo(repoRoot, branch, head string) error {
+	t, err := trackingInfo(repoRoot, branch, head)
+	if err != nil || t == nil {
+		return err
+	}
+	if t.gone {
+		fmt.Printf("Your branch is based on '%s', but the upstream is gone.\n", t.name)
+		fmt.Println(`  (use "drift branch --unset-upstream" to fixup)`)
+		return nil
+	}
+
+	plural := func(n int) string {
+		if n == 1 {
+			return "commit"
+		}
+		return "commits"
+	}
+	switch {
+	case t.ahead == 0 && t.behind == 0:
+		fmt.Printf("Your branch is up to date with '%s'.\n", t.name)
+	case t.behind == 0:
+		fmt.Printf("Your branch is ahead of '%s' by %d %s.\n", t.name, t.ahead, plural(t.ahead))
+	case t.ahead == 0:
+		fmt.Printf("Your branch is behind '%s' by %d %s, and can be fast-forwarded.\n", t.name, t.behind, plural(t.behind))
+	default:
+		fmt.Printf("Your branch and '%s' have diverged,\n", t.name)
+		fmt.Printf("and have %d and %d different commits each, respectively.\n", t.ahead, t.behind)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+func TestRemoteTrackingAheadBehind(t *testing.T) {
+	c, repoRoot := initTestRepo(t)
+	commit := func(msg string) {
+		t.Helper()
+		if err := os.WriteFile("f", []byte(msg+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("f", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit(msg, CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(branch string, wantAhead, wantBehind int) {
+		t.Helper()
+		head, err := resolveCommit(repoRoot, branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := trackingInfo(repoRoot, branch, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.gone || got.name != "peer1/main" || got.ahead != wantAhead || got.behind != wantBehind {
+			t.Fatalf("tracking = %+v, want peer1/main ahead %d behind %d", got, wantAhead, wantBehind)
+		}
+	}
+
+	commit("one")
+	commit("two")
+	if err := c.SetUpstream("", "peer1/main"); err == nil {
+		t.Fatal("tracking a remote branch that does not exist succeeded")
+	}
+	if err := c.UpdateRef(utils.RemotePrefix+"peer1/main", "HEAD~1", utils.ZeroHash, UpdateRefOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetUpstream("", "peer1/main"); err != nil {
+		t.Fatal(err)
+	}
+	check("main", 1, 0)
+
+	// The peer catches up, leaving a branch at the old commit behind.
+	if err := c.UpdateRef(utils.RemotePrefix+"peer1/main", "HEAD", "HEAD~1", UpdateRefOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	check("main", 0, 0)
+	if err := c.CreateBranch("old", "HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetUpstream("old", "peer1/main"); err != nil {
+		t.Fatal(err)
+	}
+	check("old", 0, 1)
+	if err := c.UpdateRef(utils.RemotePrefix+"peer1/main", "old", "old", UpdateRefOptions{}); err == nil {
+		t.Fatal("update with a stale old value succeeded")
+	}
+
+	if err := c.UpdateRef(utils.RemotePrefix+"peer1/main", "", "", UpdateRefOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := trackingInfo(repoRoot, "main", head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !got.gone {
+		t.Fatalf("tracking = %+v after deleting the remote ref, want gone", got)
+	}
+}
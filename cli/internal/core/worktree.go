@@ -0,0 +1,327 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/media"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// commitFiles returns the flattened tree of a commit, or an empty map for
+// the "" commit of an unborn branch.
+func commitFiles(repoRoot, commitHash string) (map[string]utils.TreeEntry, error) {
+	if commitHash == "" {
+		return map[string]utils.TreeEntry{}, nil
+	}
+	commit, err := utils.ReadCommit(repoRoot, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	return utils.FlattenTree(repoRoot, commit.Tree)
+}
+
+// worktreeHash returns the blob id of the working copy of path, and false
+// if the file does not exist or a directory stands in its place. A symlink
+// hashes as its target path.
+func worktreeHash(repoRoot, path string) (string, bool, error) {
+	full := filepath.Join(repoRoot, filepath.FromSlash(path))
+	info, err := os.Lstat(full)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return "", false, nil
+	}
+	if index.FileMode(info) == index.ModeSymlink {
+		target, err := os.Readlink(full)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read symlink %s: %v", path, err)
+		}
+		return objects.Hash("blob", []byte(target)), true, nil
+	}
+	if p, ok, err := worktreePointer(repoRoot, path, info); err != nil {
+		return "", false, err
+	} else if ok {
+		return objects.Hash("blob", p.Bytes()), true, nil
+	}
+
+	hash, err := objects.HashFile(full)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hash, true, nil
+}
+
+// checkWorktreeParents refuses a path that would leave the working tree:
+// one with a component such as ".." or ".drift", or whose leading
+// directories include a symlink, which MkdirAll and OpenFile would follow.
+func checkWorktreeParents(repoRoot, name string) error {
+	parts := strings.Split(name, "/")
+	for _, part := range parts {
+		if !utils.ValidTreeName(part) {
+			return fmt.Errorf("refusing to write %q: invalid path", name)
+		}
+	}
+	dir := repoRoot
+	for i, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %v", strings.Join(parts[:i+1], "/"), err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write %s: %s is a symbolic link", name, strings.Join(parts[:i+1], "/"))
+		}
+	}
+	return nil
+}
+
+// writeWorktreeFile writes the blob of e to the working tree and returns
+// the resulting index entry.
+func writeWorktreeFile(repoRoot string, store *objects.Store, e utils.TreeEntry) (index.Entry, error) {
+	r, err := store.Open(e.Hash)
+	if err != nil {
+		return index.Entry{}, err
+	}
+	defer r.Close()
+	if r.Type != "blob" {
+		return index.Entry{}, fmt.Errorf("object %s for %s is a %s, not a blob", e.Hash, e.Name, r.Type)
+	}
+
+	if err := checkWorktreeParents(repoRoot, e.Name); err != nil {
+		return index.Entry{}, err
+	}
+	path := filepath.Join(repoRoot, filepath.FromSlash(e.Name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return index.Entry{}, fmt.Errorf("failed to create directory for %s: %v", e.Name, err)
+	}
+	// A directory may be in the way when a tree turns into a file, and an
+	// old symlink must be replaced rather than written through.
+	if info, err := os.Lstat(path); err == nil {
+		switch {
+		case info.IsDir():
+			if err := os.RemoveAll(path); err != nil {
+				return index.Entry{}, fmt.Errorf("failed to remove directory %s: %v", e.Name, err)
+			}
+		case index.FileMode(info) == index.ModeSymlink || e.Mode == index.ModeSymlink:
+			if err := os.Remove(path); err != nil {
+				return index.Entry{}, fmt.Errorf("failed to remove %s: %v", e.Name, err)
+			}
+		}
+	}
+
+	switch e.Mode {
+	case index.ModeSymlink:
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return index.Entry{}, fmt.Errorf("failed to read %s: %v", e.Name, err)
+		}
+		if err := os.Symlink(string(target), path); err != nil {
+			return index.Entry{}, fmt.Errorf("failed to create symlink %s: %v", e.Name, err)
+		}
+	default:
+		perm := os.FileMode(0644)
+		if e.Mode == index.ModeExecutable {
+			perm = 0755
+		}
+		var content io.Reader = r
+		if r.Size <= media.MaxPointerSize {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return index.Entry{}, fmt.Errorf("failed to read %s: %v", e.Name, err)
+			}
+			content = bytes.NewReader(data)
+			// A pointer blob is replaced by its media content. If that
+			// cannot be had, the pointer itself is checked out so that the
+			// rest of the checkout goes ahead; media fetch fills it in later.
+			if p, ok := media.ParsePointer(data); ok {
+				if mr, err := openMedia(repoRoot, p); err != nil {
+					fmt.Printf("warning: %s: %v; leaving its pointer in place\n", e.Name, err)
+				} else {
+					defer mr.Close()
+					content = mr
+				}
+			}
+		}
+		// Blobs are streamed to disk, so large files never sit in memory.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		if err != nil {
+			return index.Entry{}, fmt.Errorf("failed to write %s: %v", e.Name, err)
+		}
+		_, err = io.Copy(f, content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return index.Entry{}, fmt.Errorf("failed to write %s: %v", e.Name, err)
+		}
+		// OpenFile keeps the permissions of a file that already exists.
+		if err := os.Chmod(path, perm); err != nil {
+			return index.Entry{}, fmt.Errorf("failed to set mode of %s: %v", e.Name, err)
+		}
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return index.Entry{}, fmt.Errorf("failed to stat %s: %v", e.Name, err)
+	}
+	return index.NewEntry(e.Name, e.Mode, e.Hash, info), nil
+}
+
+// removeWorktreeFile deletes a tracked file and any directories it leaves
+// empty.
+func removeWorktreeFile(repoRoot, path string) error {
+	full := filepath.Join(repoRoot, filepath.FromSlash(path))
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	utils.RemoveEmptyDirs(filepath.Dir(full), repoRoot)
+	return nil
+}
+
+func sameEntry(a, b utils.TreeEntry, aOK, bOK bool) bool {
+	if aOK != bOK {
+		return false
+	}
+	return !aOK || (a.Hash == b.Hash && a.Mode == b.Mode)
+}
+
+// checkoutTree moves the index and working tree from the commit fromCommit
+// to toCommit. Paths that are identical in both commits are left alone, so
+// local changes to them are carried over. Unless force is set, it refuses
+// to touch a path whose staged or working copy differs from fromCommit.
+func checkoutTree(repoRoot, fromCommit, toCommit string, force bool) error {
+	from, err := commitFiles(repoRoot, fromCommit)
+	if err != nil {
+		return err
+	}
+	to, err := commitFiles(repoRoot, toCommit)
+	if err != nil {
+		return err
+	}
+	store := objects.NewStore(repoRoot)
+
+	return index.Update(repoRoot, func(idx *index.Index) error {
+		paths := map[string]bool{}
+		for p := range from {
+			paths[p] = true
+		}
+		for p := range to {
+			paths[p] = true
+		}
+		if force {
+			for _, e := range idx.Entries() {
+				paths[e.Path] = true
+			}
+		}
+
+		changes := []string{}
+		conflicts := []string{}
+		for p := range paths {
+			f, fOK := from[p]
+			t, tOK := to[p]
+			if !force && sameEntry(f, t, fOK, tOK) {
+				continue
+			}
+			changes = append(changes, p)
+			if force {
+				continue
+			}
+			if dirty, err := pathIsDirty(repoRoot, idx, p, f, fOK, t, tOK); err != nil {
+				return err
+			} else if dirty {
+				conflicts = append(conflicts, p)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return fmt.Errorf(
+				"Your local changes to the following files would be overwritten by checkout:\n\t%s\n"+
+					"Please commit your changes before you switch branches, or use --force to discard them.\n"+
+					"Aborting",
+				strings.Join(conflicts, "\n\t"),
+			)
+		}
+
+		// Removals go first, so that a directory whose files are gone can
+		// give way to a file or symlink of the same name.
+		sort.Strings(changes)
+		for _, p := range changes {
+			if _, tOK := to[p]; !tOK {
+				if err := removeWorktreeFile(repoRoot, p); err != nil {
+					return err
+				}
+				idx.Remove(p)
+			}
+		}
+		for _, p := range changes {
+			t, tOK := to[p]
+			if !tOK {
+				continue
+			}
+			t.Name = p
+			entry, err := writeWorktreeFile(repoRoot, store, t)
+			if err != nil {
+				return err
+			}
+			idx.Add(entry)
+		}
+		return nil
+	})
+}
+
+// pathIsDirty reports whether switching path p from f to t would lose
+// staged or unstaged work.
+func pathIsDirty(
+	repoRoot string,
+	idx *index.Index,
+	p string,
+	f utils.TreeEntry, fOK bool,
+	t utils.TreeEntry, tOK bool,
+) (bool, error) {
+	ie, inIdx := idx.Get(p)
+	wHash, wOK, err := worktreeHash(repoRoot, p)
+	if err != nil {
+		return false, err
+	}
+
+	if !inIdx {
+		if fOK {
+			// Removal of the path is staged; only fine if the target
+			// removes it too and nothing was recreated in its place.
+			return tOK || wOK, nil
+		}
+		// Untracked file in the way of a file the target adds.
+		return tOK && wOK && wHash != t.Hash, nil
+	}
+
+	staged := ie.Hash
+	if !fOK || staged != f.Hash {
+		// Staged content differs from the commit being left. That is only
+		// safe if it already equals the target and the working copy
+		// agrees.
+		return !(tOK && staged == t.Hash && wOK && wHash == staged), nil
+	}
+	if !wOK {
+		return tOK, nil
+	}
+	return wHash != staged, nil
+}
@@ -0,0 +1,385 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+	"github.com/sammanbajracharya/drift_cli/internal/utils"
+)
+
+// fileState is what a path holds in the working tree: a regular file with
+// the given mode, or a symlink to target.
+type fileState struct {
+	mode   string
+	data   string
+	target string
+}
+
+func (s fileState) write(t *testing.T, path string) {
+	t.Helper()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if s.mode == index.ModeSymlink {
+		if err := os.Symlink(s.target, path); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	perm := os.FileMode(0644)
+	if s.mode == index.ModeExecutable {
+		perm = 0755
+	}
+	if err := os.WriteFile(path, []byte(s.data), perm); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile leaves the mode of an existing file alone and is subject
+	// to the umask.
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s fileState) check(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.mode == index.ModeSymlink {
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s is %v, want a symlink", path, info.Mode())
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != s.target {
+			t.Fatalf("%s links to %q, want %q", path, target, s.target)
+		}
+		return
+	}
+	if !info.Mode().IsRegular() {
+		t.Fatalf("%s is %v, want a regular file", path, info.Mode())
+	}
+	exec := info.Mode().Perm()&0111 != 0
+	if exec != (s.mode == index.ModeExecutable) {
+		t.Fatalf("%s has mode %v, want %s", path, info.Mode().Perm(), s.mode)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != s.data {
+		t.Fatalf("%s holds %q, want %q", path, data, s.data)
+	}
+}
+
+func initTestRepo(t *testing.T) (*Context, string) {
+	t.Helper()
+	repoRoot := t.TempDir()
+	t.Chdir(repoRoot)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	global := "[user]\nname = Test\nemail = test@example.com\n[peer]\nid = test\n"
+	if err := os.MkdirAll(filepath.Join(home, ".drift"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".drift", "config"), []byte(global), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Context{}
+	if err := c.InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	return c, repoRoot
+}
+
+func headTreeMode(t *testing.T, repoRoot, path string) string {
+	t.Helper()
+	hash, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := utils.ReadCommit(repoRoot, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := utils.FlattenTree(repoRoot, commit.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := files[path]
+	if !ok {
+		t.Fatalf("%s is not in the HEAD tree", path)
+	}
+	return e.Mode
+}
+
+func TestModeTransitions(t *testing.T) {
+	file := fileState{mode: index.ModeFile, data: "echo hi\n"}
+	exec := fileState{mode: index.ModeExecutable, data: "echo hi\n"}
+	link := fileState{mode: index.ModeSymlink, target: "other"}
+
+	tests := []struct {
+		name     string
+		from, to fileState
+	}{
+		{"644 to 755", file, exec},
+		{"755 to 644", exec, file},
+		{"file to symlink", file, link},
+		{"symlink to file", link, file},
+		{"symlink to 755", link, exec},
+		{"755 to symlink", exec, link},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, repoRoot := initTestRepo(t)
+			path := filepath.Join(repoRoot, "f")
+			if err := os.WriteFile(filepath.Join(repoRoot, "other"), []byte("other\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.from.write(t, path)
+			if err := c.Add(".", false); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Commit("from", CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := headTreeMode(t, repoRoot, "f"); got != tt.from.mode {
+				t.Fatalf("first commit stores mode %s, want %s", got, tt.from.mode)
+			}
+			if err := c.Checkout("main", CheckoutOptions{NewBranch: "from"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Checkout("main", CheckoutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.to.write(t, path)
+			if err := c.Add("f", false); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Commit("to", CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := headTreeMode(t, repoRoot, "f"); got != tt.to.mode {
+				t.Fatalf("second commit stores mode %s, want %s", got, tt.to.mode)
+			}
+
+			if err := c.Checkout("from", CheckoutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := headTreeMode(t, repoRoot, "f"); got != tt.from.mode {
+				t.Fatalf("after checkout HEAD has mode %s, want %s", got, tt.from.mode)
+			}
+			tt.from.check(t, path)
+
+			if err := c.Checkout("main", CheckoutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			tt.to.check(t, path)
+		})
+	}
+}
+
+// commitTree stores a commit on top of HEAD whose root tree holds entries
+// as given, without the checks a commit from the index would go through.
+func commitTree(t *testing.T, repoRoot string, entries []utils.TreeEntry) string {
+	t.Helper()
+	store := objects.NewStore(repoRoot)
+	tree, err := store.Put("tree", utils.SerializeTree(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := utils.ResolveHead(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := writeCommitObject(repoRoot, tree, []string{head}, "crafted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func putBlob(t *testing.T, repoRoot, content string) string {
+	t.Helper()
+	hash, err := objects.NewStore(repoRoot).Put("blob", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestCheckoutStaysInWorktree(t *testing.T) {
+	t.Run("symlink and directory with the same name", func(t *testing.T) {
+		c, repoRoot := initTestRepo(t)
+		outside := t.TempDir()
+		if err := os.WriteFile("f", []byte("f\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("f", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit("base", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		store := objects.NewStore(repoRoot)
+		sub, err := store.Put("tree", utils.SerializeTree([]utils.TreeEntry{
+			{Mode: index.ModeFile, Type: "blob", Hash: putBlob(t, repoRoot, "escaped\n"), Name: "x"},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit := commitTree(t, repoRoot, []utils.TreeEntry{
+			{Mode: index.ModeSymlink, Type: "blob", Hash: putBlob(t, repoRoot, outside), Name: "a"},
+			{Mode: "040000", Type: "tree", Hash: sub, Name: "a"},
+			{Mode: index.ModeFile, Type: "blob", Hash: putBlob(t, repoRoot, "f\n"), Name: "f"},
+		})
+
+		if err := c.Merge(commit); err == nil {
+			t.Fatal("merging a tree with a duplicated name succeeded")
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "x")); !os.IsNotExist(err) {
+			t.Fatalf("merge wrote outside the worktree (stat: %v)", err)
+		}
+		if _, err := os.Lstat(filepath.Join(repoRoot, "a")); !os.IsNotExist(err) {
+			t.Fatalf("failed merge left a in the worktree (stat: %v)", err)
+		}
+	})
+
+	for _, name := range []string{"../escaped", "..", ".", "", ".drift", "a/b", "nul\x00"} {
+		t.Run("entry named "+strconv.Quote(name), func(t *testing.T) {
+			c, repoRoot := initTestRepo(t)
+			if err := os.WriteFile("f", []byte("f\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Add("f", false); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Commit("base", CommitOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			commit := commitTree(t, repoRoot, []utils.TreeEntry{
+				{Mode: index.ModeFile, Type: "blob", Hash: putBlob(t, repoRoot, "f\n"), Name: "f"},
+				{Mode: index.ModeFile, Type: "blob", Hash: putBlob(t, repoRoot, "g\n"), Name: "g"},
+				{Mode: index.ModeFile, Type: "blob", Hash: putBlob(t, repoRoot, "escaped\n"), Name: name},
+			})
+
+			if err := c.Merge(commit); err == nil {
+				t.Fatal("merge succeeded")
+			}
+			if err := c.Checkout(commit, CheckoutOptions{Detach: true}); err == nil {
+				t.Fatal("checkout succeeded")
+			}
+			if err := c.Restore([]string{"."}, RestoreOptions{Source: commit, Worktree: true}); err == nil {
+				t.Fatal("restore succeeded")
+			}
+			if _, err := os.Lstat(filepath.Join(repoRoot, "g")); !os.IsNotExist(err) {
+				t.Fatalf("a failed checkout wrote g (stat: %v)", err)
+			}
+			if _, err := os.Lstat(filepath.Join(repoRoot, "..", "escaped")); !os.IsNotExist(err) {
+				t.Fatalf("checkout wrote outside the worktree (stat: %v)", err)
+			}
+		})
+	}
+
+	t.Run("symlink replaced by a directory", func(t *testing.T) {
+		c, repoRoot := initTestRepo(t)
+		a := filepath.Join(repoRoot, "a")
+		if err := os.Symlink(t.TempDir(), a); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("a", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit("link", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Checkout("main", CheckoutOptions{NewBranch: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(a, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(a, "x"), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("a", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit("directory", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, branch := range []string{"main", "topic", "main"} {
+			if err := c.Checkout(branch, CheckoutOptions{}); err != nil {
+				t.Fatalf("checkout %s: %v", branch, err)
+			}
+		}
+		info, err := os.Lstat(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("a is %v after checking out main, want a symlink", info.Mode())
+		}
+		if err := c.Merge("topic"); err != nil {
+			t.Fatal(err)
+		}
+		fileState{mode: index.ModeFile, data: "x\n"}.check(t, filepath.Join(a, "x"))
+	})
+
+	t.Run("untracked symlink in the way", func(t *testing.T) {
+		c, repoRoot := initTestRepo(t)
+		outside := t.TempDir()
+		if err := os.WriteFile("f", []byte("f\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("f", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit("base", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Checkout("main", CheckoutOptions{NewBranch: "topic"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(repoRoot, "a"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, "a", "x"), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add("a", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Commit("add a/x", CommitOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Checkout("main", CheckoutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink(outside, filepath.Join(repoRoot, "a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Checkout("topic", CheckoutOptions{}); err == nil {
+			t.Fatal("checkout through a symlinked directory succeeded")
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "x")); !os.IsNotExist(err) {
+			t.Fatalf("checkout wrote outside the worktree (stat: %v)", err)
+		}
+	})
+}
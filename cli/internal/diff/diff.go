@@ -0,0 +1,169 @@
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is one step of an edit script turning a into b. A is the line index
+// in a for Equal and Delete edits, B the line index in b for Equal and
+// Insert edits; the unused index is -1.
+type Edit struct {
+	Op Op
+	A  int
+	B  int
+}
+
+// SplitLines splits s into lines, keeping each line's trailing newline so
+// that joining the result gives back s exactly.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines computes a shortest edit script from a to b using Myers' O(ND)
+// algorithm. Common prefixes and suffixes are stripped first, which keeps
+// the search small for the typical case of a few local changes.
+func Lines(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, Edit{Op: Equal, A: i, B: i})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, Edit{Op: Equal, A: len(a) - suffix + i, B: len(b) - suffix + i})
+	}
+	return edits
+}
+
+// maxSnakeCost bounds the middle snake search of each subproblem. A
+// subproblem that needs more edits than twice this is taken as a full
+// replace, which keeps time bounded when two large inputs share almost
+// nothing.
+const maxSnakeCost = 1024
+
+// myers computes the edit script with the linear-space variant of Myers'
+// algorithm: it finds the middle snake of an optimal path and recurses on
+// either side of it, so memory stays proportional to len(a)+len(b).
+func myers(a, b []string, offA, offB int) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	return diffRange(a, b, offA, offB, edits)
+}
+
+func diffRange(a, b []string, offA, offB int, edits []Edit) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		edits = append(edits, Edit{Op: Equal, A: offA + prefix, B: offB + prefix})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	offA, offB = offA+prefix, offB+prefix
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y, u, v, ok := middleSnake(a, b)
+	switch {
+	case len(a) == 0 || len(b) == 0 || !ok:
+		for i := range a {
+			edits = append(edits, Edit{Op: Delete, A: offA + i, B: -1})
+		}
+		for j := range b {
+			edits = append(edits, Edit{Op: Insert, A: -1, B: offB + j})
+		}
+	default:
+		edits = diffRange(a[:x], b[:y], offA, offB, edits)
+		for i := 0; i < u-x; i++ {
+			edits = append(edits, Edit{Op: Equal, A: offA + x + i, B: offB + y + i})
+		}
+		edits = diffRange(a[u:], b[v:], offA+u, offB+v, edits)
+	}
+
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, Edit{Op: Equal, A: offA + len(a) + i, B: offB + len(b) + i})
+	}
+	return edits
+}
+
+// middleSnake runs the forward and backward searches until they meet and
+// returns the snake where they do, from (x, y) to (u, v). It reports false
+// if the searches do not meet within maxSnakeCost rounds. a and b must be
+// non-empty and differ in their first and last lines.
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, 0, 0, false
+	}
+	delta := n - m
+	odd := delta&1 != 0
+	limit := min((n+m+1)/2, maxSnakeCost)
+
+	// vf[k] is the furthest x reached on diagonal k = x-y going forward;
+	// vb[c] the furthest distance from the end reached on diagonal c going
+	// backward, where c counts from the bottom-right corner.
+	off := limit + 1
+	vf := make([]int, 2*off+1)
+	vb := make([]int, 2*off+1)
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+vb[off+c] >= n {
+				return sx, sy, x, y, true
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || (c != d && vb[off+c-1] < vb[off+c+1]) {
+				x = vb[off+c+1]
+			} else {
+				x = vb[off+c-1] + 1
+			}
+			y := x - c
+			sx, sy := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			vb[off+c] = x
+			if k := delta - c; !odd && k >= -d && k <= d && x+vf[off+k] >= n {
+				return n - x, m - y, n - sx, m - sy, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
@@ -0,0 +1,138 @@
+package diff
+
+import "strings"
+
+const (
+	MarkerOurs   = "<<<<<<<"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>>"
+)
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Content   string
+	Conflicts int
+}
+
+// matches maps each line of base that survives unchanged in other to its
+// index in other, or -1.
+func matches(base, other []string) []int {
+	m := make([]int, len(base))
+	for i := range m {
+		m[i] = -1
+	}
+	for _, e := range Lines(base, other) {
+		if e.Op == Equal {
+			m[e.A] = e.B
+		}
+	}
+	return m
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs line
+// by line. Regions changed on only one side take that side; regions changed
+// identically on both sides are taken once; anything else is emitted
+// between conflict markers labelled oursLabel and theirsLabel.
+func Merge3(base, ours, theirs, oursLabel, theirsLabel string) MergeResult {
+	b, o, t := SplitLines(base), SplitLines(ours), SplitLines(theirs)
+	mo, mt := matches(b, o), matches(b, t)
+
+	var out strings.Builder
+	result := MergeResult{}
+	i, j, k := 0, 0, 0
+
+	for i < len(b) || j < len(o) || k < len(t) {
+		// Copy the run of base lines that are unchanged on both sides.
+		if i < len(b) && mo[i] == j && mt[i] == k {
+			out.WriteString(b[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		// Find the next base line that is stable on both sides; everything
+		// before it is one unstable chunk.
+		next := i
+		for next < len(b) && (mo[next] < j || mt[next] < k) {
+			next++
+		}
+		endO, endT := len(o), len(t)
+		if next < len(b) {
+			endO, endT = mo[next], mt[next]
+		}
+
+		bc, oc, tc := b[i:next], o[j:endO], t[k:endT]
+		switch {
+		case equalLines(oc, bc):
+			writeLines(&out, tc)
+		case equalLines(tc, bc), equalLines(oc, tc):
+			writeLines(&out, oc)
+		default:
+			result.Conflicts++
+			writeConflict(&out, oc, tc, oursLabel, theirsLabel)
+		}
+		i, j, k = next, endO, endT
+	}
+
+	result.Content = out.String()
+	return result
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, l := range lines {
+		out.WriteString(l)
+	}
+}
+
+func writeConflict(out *strings.Builder, ours, theirs []string, oursLabel, theirsLabel string) {
+	out.WriteString(MarkerOurs + " " + oursLabel + "\n")
+	writeTerminated(out, ours)
+	out.WriteString(MarkerSep + "\n")
+	writeTerminated(out, theirs)
+	out.WriteString(MarkerTheirs + " " + theirsLabel + "\n")
+}
+
+// writeTerminated writes lines and makes sure the last one ends in a
+// newline so the following marker starts on its own line.
+func writeTerminated(out *strings.Builder, lines []string) {
+	writeLines(out, lines)
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// HasConflictMarkers reports whether content still contains an unresolved
+// conflict block.
+func HasConflictMarkers(content string) bool {
+	for _, line := range SplitLines(content) {
+		if strings.HasPrefix(line, MarkerOurs+" ") || strings.HasPrefix(line, MarkerTheirs+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBinary guesses whether content is binary by looking for a NUL byte in
+// its first 8000 bytes.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	for _, c := range content {
+		if c == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package diff
+
+// Line is one line of a hunk.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is a group of nearby changes with their surrounding context, as
+// shown after an "@@ -OldStart,OldLines +NewStart,NewLines @@" header.
+// Start lines are 1-based; a start of 0 means the side is empty.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Hunks groups the edit script from a to b into hunks with up to context
+// unchanged lines around each change. Changes separated by no more than
+// 2*context unchanged lines share a hunk.
+func Hunks(a, b []string, context int) []Hunk {
+	edits := Lines(a, b)
+
+	hunks := []Hunk{}
+	i := 0
+	for i < len(edits) {
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk while the next change is close enough.
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		h := Hunk{}
+		for _, e := range edits[start:stop] {
+			switch e.Op {
+			case Equal:
+				h.Lines = append(h.Lines, Line{Op: Equal, Text: a[e.A]})
+				h.OldLines++
+				h.NewLines++
+			case Delete:
+				h.Lines = append(h.Lines, Line{Op: Delete, Text: a[e.A]})
+				h.OldLines++
+			case Insert:
+				h.Lines = append(h.Lines, Line{Op: Insert, Text: b[e.B]})
+				h.NewLines++
+			}
+		}
+		h.OldStart, h.NewStart = hunkStarts(edits, start)
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+		i = stop
+	}
+	return hunks
+}
+
+// hunkStarts returns the 1-based line numbers in a and b at which the edit
+// at position pos begins.
+func hunkStarts(edits []Edit, pos int) (int, int) {
+	oldLine, newLine := 1, 1
+	for _, e := range edits[:pos] {
+		if e.Op != Insert {
+			oldLine++
+		}
+		if e.Op != Delete {
+			newLine++
+		}
+	}
+	return oldLine, newLine
+}
+
+// Stat counts the inserted and deleted lines between a and b.
+func Stat(a, b []string) (insertions, deletions int) {
+	for _, e := range Lines(a, b) {
+		switch e.Op {
+		case Insert:
+			insertions++
+		case Delete:
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
@@ -0,0 +1,245 @@
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const FileName = ".driftignore"
+
+// Pattern is one compiled line of an ignore file.
+type Pattern struct {
+	Source  string // file the pattern came from
+	Line    int
+	Text    string // the line as written
+	Negate  bool
+	DirOnly bool
+
+	base string // slash-separated directory the pattern is relative to
+	re   *regexp.Regexp
+}
+
+// Matcher answers whether repository paths are ignored, following
+// gitignore rules: later patterns override earlier ones, files in deeper
+// directories override their parents, and the global excludes file has the
+// lowest precedence.
+type Matcher struct {
+	root   string
+	global []Pattern
+	dirs   map[string][]Pattern
+}
+
+// New creates a matcher for the repository at repoRoot. excludesFile is an
+// optional global ignore file; it is skipped if it does not exist.
+func New(repoRoot, excludesFile string) (*Matcher, error) {
+	m := &Matcher{root: repoRoot, dirs: map[string][]Pattern{}}
+	if excludesFile != "" {
+		patterns, err := ParseFile(excludesFile, excludesFile, "")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		m.global = patterns
+	}
+	return m, nil
+}
+
+// ParseFile reads an ignore file. source is the name reported for its
+// patterns and base the slash-separated directory they are relative to.
+func ParseFile(file, source, base string) ([]Pattern, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := []Pattern{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		p, ok, err := Compile(scanner.Text(), base)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", source, lineNo, err)
+		}
+		if !ok {
+			continue
+		}
+		p.Source = source
+		p.Line = lineNo
+		patterns = append(patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", source, err)
+	}
+	return patterns, nil
+}
+
+// Compile parses a single ignore line. ok is false for blank lines and
+// comments.
+func Compile(line, base string) (Pattern, bool, error) {
+	p := Pattern{Text: line, base: base}
+
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false, nil
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	body, err := globToRegexp(line)
+	if err != nil {
+		return p, false, err
+	}
+	if anchored {
+		body = "^" + body + "$"
+	} else {
+		body = "^(?:.*/)?" + body + "$"
+	}
+	re, err := regexp.Compile(body)
+	if err != nil {
+		return p, false, fmt.Errorf("invalid pattern %q: %v", p.Text, err)
+	}
+	p.re = re
+	return p, true, nil
+}
+
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// matches reports whether p applies to the slash-separated repository path
+// rel.
+func (p Pattern) matches(rel string, isDir bool) bool {
+	if p.DirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return p.re.MatchString(rel)
+}
+
+// patternsFor loads the ignore file of a directory, caching the result.
+func (m *Matcher) patternsFor(dir string) []Pattern {
+	if patterns, ok := m.dirs[dir]; ok {
+		return patterns
+	}
+	source := FileName
+	if dir != "" {
+		source = dir + "/" + FileName
+	}
+	patterns, err := ParseFile(filepath.Join(m.root, filepath.FromSlash(source)), source, dir)
+	if err != nil {
+		patterns = nil
+	}
+	m.dirs[dir] = patterns
+	return patterns
+}
+
+// match returns the last pattern matching rel itself, ignoring parents.
+func (m *Matcher) match(rel string, isDir bool) (Pattern, bool) {
+	var found Pattern
+	ok := false
+	check := func(patterns []Pattern) {
+		for _, p := range patterns {
+			if p.matches(rel, isDir) {
+				found, ok = p, true
+			}
+		}
+	}
+
+	check(m.global)
+	check(m.patternsFor(""))
+	dir := ""
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = path.Join(dir, part)
+		check(m.patternsFor(dir))
+	}
+	return found, ok
+}
+
+// Match returns the pattern deciding whether rel is ignored. A path inside
+// an ignored directory is ignored by that directory's pattern, since files
+// cannot be re-included once a parent is excluded.
+func (m *Matcher) Match(rel string, isDir bool) (Pattern, bool) {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" || rel == "." {
+		return Pattern{}, false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if p, ok := m.match(strings.Join(parts[:i], "/"), true); ok && !p.Negate {
+			return p, true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// Ignored reports whether rel is excluded.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	if rel == ".drift" || strings.HasPrefix(filepath.ToSlash(rel), ".drift/") {
+		return true
+	}
+	p, ok := m.Match(rel, isDir)
+	return ok && !p.Negate
+}
@@ -0,0 +1,189 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/lockfile"
+)
+
+const header = "DRIFTINDEX 1"
+
+// Entry is one staged file. Path is slash-separated and relative to the
+// repository root; the stat fields let callers tell whether the working
+// file changed since it was staged without re-hashing it.
+type Entry struct {
+	Path  string
+	Mode  string
+	Hash  string
+	Size  int64
+	MTime int64
+	Ino   uint64
+}
+
+// Index is the staging area, keyed by path.
+type Index struct {
+	entries map[string]Entry
+	// modTime is when the index file was last written, in nanoseconds.
+	modTime int64
+}
+
+func New() *Index {
+	return &Index{entries: map[string]Entry{}}
+}
+
+func Path(repoRoot string) string {
+	return filepath.Join(repoRoot, ".drift", "index")
+}
+
+// Read loads the index of the repository at repoRoot. A missing or empty
+// index file yields an empty index.
+func Read(repoRoot string) (*Index, error) {
+	data, err := os.ReadFile(Path(repoRoot))
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading index file: %v", err)
+	}
+	info, err := os.Stat(Path(repoRoot))
+	if err != nil {
+		return nil, fmt.Errorf("error reading index file: %v", err)
+	}
+	idx, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	idx.modTime = info.ModTime().UnixNano()
+	return idx, nil
+}
+
+// Parse decodes an index file. Files without the version header use the
+// original "mode hash path" layout and are loaded without stat data.
+func Parse(data []byte) (*Index, error) {
+	idx := New()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	legacy := true
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			first = false
+			if line == header {
+				legacy = false
+				continue
+			}
+		}
+		if line == "" {
+			continue
+		}
+
+		if legacy {
+			parts := strings.SplitN(line, " ", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("malformed index entry %q", line)
+			}
+			idx.Add(Entry{Mode: parts[0], Hash: parts[1], Path: filepath.ToSlash(parts[2])})
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 6)
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("malformed index entry %q", line)
+		}
+		size, err1 := strconv.ParseInt(parts[2], 10, 64)
+		mtime, err2 := strconv.ParseInt(parts[3], 10, 64)
+		ino, err3 := strconv.ParseUint(parts[4], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("malformed index entry %q", line)
+		}
+		idx.Add(Entry{
+			Mode:  parts[0],
+			Hash:  parts[1],
+			Size:  size,
+			MTime: mtime,
+			Ino:   ino,
+			Path:  parts[5],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading index: %v", err)
+	}
+	return idx, nil
+}
+
+// Bytes encodes the index with entries sorted by path.
+func (idx *Index) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header + "\n")
+	for _, e := range idx.Entries() {
+		fmt.Fprintf(&buf, "%s %s %d %d %d %s\n", e.Mode, e.Hash, e.Size, e.MTime, e.Ino, e.Path)
+	}
+	return buf.Bytes()
+}
+
+// Add inserts e, replacing any entry already staged at the same path.
+func (idx *Index) Add(e Entry) {
+	idx.entries[e.Path] = e
+}
+
+func (idx *Index) Remove(path string) bool {
+	if _, ok := idx.entries[path]; !ok {
+		return false
+	}
+	delete(idx.entries, path)
+	return true
+}
+
+func (idx *Index) Get(path string) (Entry, bool) {
+	e, ok := idx.entries[path]
+	return e, ok
+}
+
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// Entries returns every entry sorted by path.
+func (idx *Index) Entries() []Entry {
+	entries := make([]Entry, 0, len(idx.entries))
+	for _, e := range idx.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Update locks the index, applies fn to its current contents and writes the
+// result back atomically. Nothing is written if fn returns an error.
+func Update(repoRoot string, fn func(idx *Index) error) error {
+	lock, err := lockfile.Acquire(Path(repoRoot))
+	if err != nil {
+		return err
+	}
+
+	idx, err := Read(repoRoot)
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := fn(idx); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Write(idx.Bytes()); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
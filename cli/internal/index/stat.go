@@ -0,0 +1,62 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Modes of the files the index tracks, as recorded in trees.
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+)
+
+// FileMode returns the mode a working file is tracked under. info must come
+// from os.Lstat so that symlinks are seen as such rather than followed. Any
+// execute bit makes a file executable.
+func FileMode(info os.FileInfo) string {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return ModeSymlink
+	case info.Mode().Perm()&0111 != 0:
+		return ModeExecutable
+	default:
+		return ModeFile
+	}
+}
+
+// NewEntry builds an index entry for a working tree file from its stat data.
+func NewEntry(relPath, mode, hash string, info os.FileInfo) Entry {
+	return Entry{
+		Path:  filepath.ToSlash(relPath),
+		Mode:  mode,
+		Hash:  hash,
+		Size:  info.Size(),
+		MTime: info.ModTime().UnixNano(),
+		Ino:   inode(info),
+	}
+}
+
+// Matches reports whether info still describes the file e was staged
+// from, in which case its content can be assumed unchanged.
+func (e Entry) Matches(info os.FileInfo) bool {
+	if e.MTime == 0 || info.IsDir() {
+		return false
+	}
+	if e.Ino != 0 && e.Ino != inode(info) {
+		return false
+	}
+	// A chmod does not touch the mtime.
+	if FileMode(info) != e.Mode {
+		return false
+	}
+	return e.Size == info.Size() && e.MTime == info.ModTime().UnixNano()
+}
+
+// IsRacy reports whether e was modified so close to when the index was
+// written that a later change within the same timestamp tick would go
+// unnoticed by Matches. Such entries must be re-hashed.
+func (idx *Index) IsRacy(e Entry) bool {
+	return e.MTime >= idx.modTime
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
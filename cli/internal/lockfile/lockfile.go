@@ -0,0 +1,73 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrLocked = errors.New("lock is held by another drift process")
+
+// Lock is an exclusively created "<path>.lock" file. Content is written to
+// the lock file and moved over the target on Commit, so readers only ever
+// see the old or the new version of the target.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+func Acquire(path string) (*Lock, error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory for %s: %v", lockPath, err)
+	}
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf(
+			"unable to create '%s': %w\n"+
+				"If no other drift process is running, remove the file manually to continue.",
+			lockPath, ErrLocked,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating lock %s: %v", lockPath, err)
+	}
+	return &Lock{path: path, file: f}, nil
+}
+
+// IsLocked reports whether a lock is currently held for path.
+func IsLocked(path string) bool {
+	_, err := os.Stat(path + ".lock")
+	return err == nil
+}
+
+func (l *Lock) Write(data []byte) error {
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("error writing %s.lock: %v", l.path, err)
+	}
+	return nil
+}
+
+// Commit flushes the lock file to disk and renames it over the target.
+func (l *Lock) Commit() error {
+	if err := l.file.Sync(); err != nil {
+		l.Rollback()
+		return fmt.Errorf("error syncing %s.lock: %v", l.path, err)
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.path + ".lock")
+		return fmt.Errorf("error closing %s.lock: %v", l.path, err)
+	}
+	if err := os.Rename(l.path+".lock", l.path); err != nil {
+		os.Remove(l.path + ".lock")
+		return fmt.Errorf("error renaming %s.lock: %v", l.path, err)
+	}
+	return nil
+}
+
+// Rollback releases the lock without touching the target.
+func (l *Lock) Rollback() {
+	l.file.Close()
+	os.Remove(l.path + ".lock")
+}
@@ -0,0 +1,40 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RepoLock is an advisory lock on a file that lives as long as the
+// repository. Commands that write objects or move refs hold it shared, so
+// any number of them can run together; commands that delete objects hold
+// it exclusively, so they never run while an object is written but not yet
+// referenced. The operating system releases it when the process exits, so
+// a crash cannot leave it behind.
+type RepoLock struct {
+	file *os.File
+}
+
+// LockRepo takes the lock on path, waiting for an exclusive holder to
+// finish when shared and failing with ErrLocked when exclusive and any
+// other process holds it.
+func LockRepo(path string, exclusive bool) (*RepoLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory for %s: %v", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock %s: %v", path, err)
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &RepoLock{file: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *RepoLock) Unlock() {
+	l.file.Close()
+}
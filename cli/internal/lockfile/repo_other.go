@@ -0,0 +1,11 @@
+//go:build !unix
+
+package lockfile
+
+import "os"
+
+// Without flock the repository lock is not enforced; gc's grace period is
+// then the only protection for objects that are not referenced yet.
+func flock(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Fetcher retrieves media content that is not in the local store. Sync
+// transports implement it so that checkout can pull media from a peer
+// only when a file is actually written out.
+type Fetcher interface {
+	// Fetch copies the content of p into dst.
+	Fetch(p Pointer, dst *Store) error
+}
+
+// DirFetcher fetches media from another repository on disk, such as a
+// peer's checkout on a shared mount.
+type DirFetcher struct {
+	Root string
+}
+
+func (f DirFetcher) Fetch(p Pointer, dst *Store) error {
+	src := NewStore(f.Root)
+	r, err := src.Open(p.OID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.Root, err)
+	}
+	defer r.Close()
+	got, err := dst.Put(r)
+	if err != nil {
+		return err
+	}
+	if got != p {
+		return fmt.Errorf("%s sent the wrong content for media object %s", f.Root, p.OID)
+	}
+	return nil
+}
+
+// NewFetcher returns the fetcher for the source configured in cfg, or nil
+// if there is none.
+func NewFetcher(cfg *Config) (Fetcher, error) {
+	if cfg.Source == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Source, ".drift")); err != nil {
+		return nil, fmt.Errorf("media.source %s is not a drift repository", cfg.Source)
+	}
+	return DirFetcher{Root: cfg.Source}, nil
+}
@@ -0,0 +1,204 @@
+// Package media keeps large files out of the object graph. drift add
+// stores such a file's content in the chunked store under .drift/media and
+// commits a small pointer blob in its place; checkout swaps the content
+// back in, fetching it first if it is not available locally.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/ini.v1"
+)
+
+const pointerHeader = "drift-media v1\n"
+
+// MaxPointerSize bounds the size of a pointer blob; anything larger is
+// ordinary content.
+const MaxPointerSize = 256
+
+// Pointer is the blob committed in place of a media file.
+type Pointer struct {
+	OID  string
+	Size int64
+}
+
+// Bytes returns the pointer blob:
+//
+//	drift-media v1
+//	oid sha256:<hex>
+//	size <bytes>
+func (p Pointer) Bytes() []byte {
+	return []byte(fmt.Sprintf("%soid sha256:%s\nsize %d\n", pointerHeader, p.OID, p.Size))
+}
+
+// ParsePointer reports whether data is a pointer blob and decodes it.
+func ParsePointer(data []byte) (Pointer, bool) {
+	if len(data) > MaxPointerSize || !bytes.HasPrefix(data, []byte(pointerHeader)) {
+		return Pointer{}, false
+	}
+	p := Pointer{Size: -1}
+	for _, line := range strings.Split(strings.TrimSpace(string(data[len(pointerHeader):])), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			p.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Pointer{}, false
+			}
+			p.Size = size
+		}
+	}
+	if len(p.OID) != sha256.Size*2 || p.Size < 0 {
+		return Pointer{}, false
+	}
+	if _, err := hex.DecodeString(p.OID); err != nil {
+		return Pointer{}, false
+	}
+	return p, true
+}
+
+// HashFile returns the pointer for the file at path without storing it.
+// A file that already holds a pointer, as left by a checkout whose media
+// could not be fetched, is returned as that pointer.
+func HashFile(path string) (Pointer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Pointer{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	if info.Size() <= MaxPointerSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return Pointer{}, err
+		}
+		if p, ok := ParsePointer(data); ok {
+			return p, nil
+		}
+		sum := sha256.Sum256(data)
+		return Pointer{OID: hex.EncodeToString(sum[:]), Size: int64(len(data))}, nil
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Pointer{}, err
+	}
+	return Pointer{OID: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// Config selects which files are stored as media. It is read from the
+// [media] section of .drift/config:
+//
+//	[media]
+//	threshold = 50MiB          ; files at least this large
+//	patterns  = *.psd, *.ckpt  ; files matching any of these globs
+//	source    = /mnt/peer/repo ; repository to fetch missing media from
+type Config struct {
+	Threshold int64
+	Patterns  []string
+	Source    string
+}
+
+// Enabled reports whether any file can be stored as media.
+func (c *Config) Enabled() bool {
+	return c.Threshold > 0 || len(c.Patterns) > 0
+}
+
+// Matches reports whether the file at the repository-relative path p,
+// of the given size, is stored as media.
+func (c *Config) Matches(p string, size int64) bool {
+	if c.Threshold > 0 && size >= c.Threshold {
+		return true
+	}
+	for _, pattern := range c.Patterns {
+		target := p
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var configCache struct {
+	sync.Mutex
+	configs map[string]*Config
+}
+
+// LoadConfig reads the media settings of the repository at repoRoot. The
+// result is cached for the life of the process.
+func LoadConfig(repoRoot string) (*Config, error) {
+	configCache.Lock()
+	defer configCache.Unlock()
+	if cfg, ok := configCache.configs[repoRoot]; ok {
+		return cfg, nil
+	}
+
+	file, err := ini.LooseLoad(filepath.Join(repoRoot, ".drift", "config"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %v", err)
+	}
+	section := file.Section("media")
+	cfg := &Config{Source: strings.TrimSpace(section.Key("source").String())}
+	if threshold := strings.TrimSpace(section.Key("threshold").String()); threshold != "" {
+		if cfg.Threshold, err = ParseSize(threshold); err != nil {
+			return nil, fmt.Errorf("invalid media.threshold: %v", err)
+		}
+	}
+	for _, pattern := range strings.Split(section.Key("patterns").String(), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid media pattern %q: %v", pattern, err)
+		}
+		cfg.Patterns = append(cfg.Patterns, pattern)
+	}
+
+	if configCache.configs == nil {
+		configCache.configs = map[string]*Config{}
+	}
+	configCache.configs[repoRoot] = cfg
+	return cfg, nil
+}
+
+// ParseSize parses a byte count with an optional binary unit: "4096",
+// "500k", "50MiB", "2G".
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	number := strings.TrimRightFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	unit := strings.ToLower(strings.TrimSpace(s[len(number):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+
+	multipliers := map[string]float64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+	multiplier, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * multiplier), nil
+}
@@ -0,0 +1,300 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// chunkSize is the size of every chunk but the last of a media object.
+// Chunks are stored by their own hash, so a file edited in place shares
+// its untouched chunks with the earlier version.
+const chunkSize = 4 << 20
+
+// Store is the media store of a repository:
+//
+//	.drift/media/chunks/xx/<sha256 of chunk>   raw chunk content
+//	.drift/media/objects/xx/<oid>              manifest: "size N" and chunk ids
+type Store struct {
+	dir string
+}
+
+func NewStore(repoRoot string) *Store {
+	return &Store{dir: filepath.Join(repoRoot, ".drift", "media")}
+}
+
+func (s *Store) chunkPath(id string) string {
+	return filepath.Join(s.dir, "chunks", id[:2], id[2:])
+}
+
+func (s *Store) manifestPath(oid string) string {
+	return filepath.Join(s.dir, "objects", oid[:2], oid[2:])
+}
+
+// writeFile writes data to path through a temporary file in the same
+// directory, so readers never see a partial chunk or manifest.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-media-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Put reads r to the end, storing its content, and returns its pointer.
+func (s *Store) Put(r io.Reader) (Pointer, error) {
+	whole := sha256.New()
+	buf := make([]byte, chunkSize)
+	chunks := []string{}
+	var size int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			whole.Write(chunk)
+			sum := sha256.Sum256(chunk)
+			id := hex.EncodeToString(sum[:])
+			if _, statErr := os.Stat(s.chunkPath(id)); os.IsNotExist(statErr) {
+				if err := writeFile(s.chunkPath(id), chunk); err != nil {
+					return Pointer{}, fmt.Errorf("failed to write media chunk: %v", err)
+				}
+			}
+			chunks = append(chunks, id)
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return Pointer{}, fmt.Errorf("failed to read media content: %v", err)
+		}
+	}
+
+	p := Pointer{OID: hex.EncodeToString(whole.Sum(nil)), Size: size}
+	if _, err := os.Stat(s.manifestPath(p.OID)); err == nil {
+		return p, nil
+	}
+	var manifest bytes.Buffer
+	fmt.Fprintf(&manifest, "size %d\n", size)
+	for _, id := range chunks {
+		manifest.WriteString(id + "\n")
+	}
+	if err := writeFile(s.manifestPath(p.OID), manifest.Bytes()); err != nil {
+		return Pointer{}, fmt.Errorf("failed to write media manifest: %v", err)
+	}
+	return p, nil
+}
+
+// readManifest returns the size and chunk ids of oid.
+func (s *Store) readManifest(oid string) (int64, []string, error) {
+	data, err := os.ReadFile(s.manifestPath(oid))
+	if err != nil {
+		return 0, nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	size, err := strconv.ParseInt(strings.TrimPrefix(lines[0], "size "), 10, 64)
+	if err != nil || !strings.HasPrefix(lines[0], "size ") {
+		return 0, nil, fmt.Errorf("malformed media manifest for %s", oid)
+	}
+	chunks := []string{}
+	for _, id := range lines[1:] {
+		if len(id) != sha256.Size*2 {
+			return 0, nil, fmt.Errorf("malformed media manifest for %s", oid)
+		}
+		chunks = append(chunks, id)
+	}
+	return size, chunks, nil
+}
+
+// Has reports whether the content of oid is fully present.
+func (s *Store) Has(oid string) bool {
+	_, chunks, err := s.readManifest(oid)
+	if err != nil {
+		return false
+	}
+	for _, id := range chunks {
+		if _, err := os.Stat(s.chunkPath(id)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Open returns the content of oid. The content is checked against oid as
+// it is read; a mismatch surfaces as an error at the end.
+func (s *Store) Open(oid string) (io.ReadCloser, error) {
+	size, chunks, err := s.readManifest(oid)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("media object %s is not available locally", oid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reader{store: s, oid: oid, size: size, chunks: chunks, hash: sha256.New()}, nil
+}
+
+type reader struct {
+	store  *Store
+	oid    string
+	size   int64
+	read   int64
+	chunks []string
+	cur    *os.File
+	buf    *bufio.Reader
+	hash   interface {
+		io.Writer
+		Sum([]byte) []byte
+	}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				if r.read != r.size || hex.EncodeToString(r.hash.Sum(nil)) != r.oid {
+					return 0, fmt.Errorf("media object %s is corrupt", r.oid)
+				}
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.store.chunkPath(r.chunks[0]))
+			if err != nil {
+				return 0, fmt.Errorf("media object %s is missing a chunk: %v", r.oid, err)
+			}
+			r.chunks = r.chunks[1:]
+			r.cur = f
+			r.buf = bufio.NewReader(f)
+		}
+		n, err := r.buf.Read(p)
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *reader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// List returns every media object in the store.
+func (s *Store) List() ([]Pointer, error) {
+	root := filepath.Join(s.dir, "objects")
+	pointers := []Pointer{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), "tmp-") {
+			return nil
+		}
+		oid := filepath.Base(filepath.Dir(path)) + d.Name()
+		size, _, err := s.readManifest(oid)
+		if err != nil {
+			return err
+		}
+		pointers = append(pointers, Pointer{OID: oid, Size: size})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media objects: %v", err)
+	}
+	return pointers, nil
+}
+
+// Prune removes the media objects not in keep, then the chunks no
+// remaining object uses. It returns how many objects it removed and the
+// bytes of chunk data freed.
+func (s *Store) Prune(keep map[string]bool, dryRun bool) (int, int64, error) {
+	all, err := s.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	used := map[string]bool{}
+	removed := 0
+	for _, p := range all {
+		_, chunks, err := s.readManifest(p.OID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if keep[p.OID] {
+			for _, id := range chunks {
+				used[id] = true
+			}
+			continue
+		}
+		removed++
+		if !dryRun {
+			if err := os.Remove(s.manifestPath(p.OID)); err != nil {
+				return 0, 0, fmt.Errorf("failed to remove media object %s: %v", p.OID, err)
+			}
+			os.Remove(filepath.Dir(s.manifestPath(p.OID)))
+		}
+	}
+
+	var freed int64
+	root := filepath.Join(s.dir, "chunks")
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || used[filepath.Base(filepath.Dir(path))+d.Name()] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		freed += info.Size()
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			os.Remove(filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune media chunks: %v", err)
+	}
+	return removed, freed, nil
+}
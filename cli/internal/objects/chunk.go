@@ -0,0 +1,258 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A blob can be stored chunked: its content is cut into "chunk" objects at
+// content-defined boundaries, and the loose file under the blob's id holds
+// zlib("chunked <blob size>\x00<chunk id>\n..."). An edit to a large file
+// only moves the boundaries near it, so the other chunks are shared with
+// earlier versions and with other files. The blob keeps its usual id, and
+// Open reassembles the content, so nothing above the store can tell.
+const (
+	chunkedType = "chunked"
+	ChunkType   = "chunk"
+)
+
+// FastCDC parameters: chunks are 16 KiB to 256 KiB and average 64 KiB.
+const (
+	chunkMin = 16 << 10
+	chunkAvg = 64 << 10
+	chunkMax = 256 << 10
+
+	// Before the average size a cut needs more zero bits, after it fewer,
+	// which pulls chunk sizes towards the average. The masks use the high
+	// bits of the fingerprint, which depend on the most input bytes.
+	chunkMaskSmall = ((1 << 18) - 1) << (64 - 18)
+	chunkMaskLarge = ((1 << 14) - 1) << (64 - 14)
+)
+
+// gear maps each byte to a random value for the rolling fingerprint. It is
+// derived from a fixed seed: changing it would move every chunk boundary
+// and defeat sharing with chunks already stored.
+var gear [256]uint64
+
+func init() {
+	x := uint64(0x6472696674) // "drift"
+	for i := range gear {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// cutPoint returns the length of the chunk that starts data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= chunkMin {
+		return n
+	}
+	if n > chunkMax {
+		n = chunkMax
+	}
+	normal := min(chunkAvg, n)
+
+	var fp uint64
+	i := chunkMin
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunker splits a stream into content-defined chunks.
+type chunker struct {
+	r       io.Reader
+	buf     []byte
+	pending []byte
+	eof     bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, chunkMax)}
+}
+
+// next returns the next chunk, or io.EOF after the last one. The chunk is
+// only valid until the following call.
+func (c *chunker) next() ([]byte, error) {
+	if !c.eof && len(c.pending) < chunkMax {
+		n := copy(c.buf, c.pending)
+		m, err := io.ReadFull(c.r, c.buf[n:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+		c.pending = c.buf[:n+m]
+	}
+	if len(c.pending) == 0 {
+		return nil, io.EOF
+	}
+	n := cutPoint(c.pending)
+	chunk := c.pending[:n]
+	c.pending = c.pending[n:]
+	return chunk, nil
+}
+
+// PutChunked stores size bytes read from r as a chunked blob and returns
+// the blob's id, which is the same as PutStream would give it.
+func (s *Store) PutChunked(size int64, r io.Reader) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	var ids strings.Builder
+	var n int64
+	c := newChunker(r)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error writing object: %v", err)
+		}
+		h.Write(chunk)
+		n += int64(len(chunk))
+		id, err := s.Put(ChunkType, chunk)
+		if err != nil {
+			return "", err
+		}
+		ids.WriteString(id + "\n")
+	}
+	if n != size {
+		return "", fmt.Errorf("expected %d bytes but read %d; was the file changed while being added?", size, n)
+	}
+
+	id := hex.EncodeToString(h.Sum(nil))
+	if s.Has(id) {
+		return id, nil
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	fmt.Fprintf(w, "%s %d\x00%s", chunkedType, size, ids.String())
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("error compressing object %s: %v", id, err)
+	}
+	if err := s.writeFile(id, buf.Bytes()); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Chunks returns the ids of the chunks a blob is stored as, or nil if it
+// is stored whole. Only the object's header, and for a chunked blob its
+// list of chunks, is read.
+func (s *Store) Chunks(hash string) ([]string, error) {
+	chunked, err := s.IsChunked(hash)
+	if err != nil || !chunked {
+		return nil, err
+	}
+	r, err := s.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.chunks, nil
+}
+
+// IsChunked reports whether hash is a blob stored as chunks, reading no
+// more than the object's header.
+func (s *Store) IsChunked(hash string) (bool, error) {
+	objType, err := s.storedType(hash)
+	return objType == chunkedType, err
+}
+
+// Chunks returns the ids of the chunks r reassembles, or nil if the object
+// is stored whole.
+func (r *Reader) Chunks() []string {
+	return r.chunks
+}
+
+// openChunked turns r, positioned after the header of a chunked blob, into
+// a reader of the reassembled blob.
+func (s *Store) openChunked(r *Reader, size int64, body *bufio.Reader) (*Reader, error) {
+	list, err := io.ReadAll(body)
+	r.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, r.id, err)
+	}
+	ids := strings.Fields(string(list))
+	for _, id := range ids {
+		if !validHash(id) {
+			return nil, fmt.Errorf("%w: %s: malformed chunk id %q", ErrCorrupt, r.id, id)
+		}
+	}
+
+	r.file, r.zr = nil, nil
+	r.Type = "blob"
+	r.Size = size
+	r.chunks = ids
+	r.hasher = sha256.New()
+	fmt.Fprintf(r.hasher, "blob %d\x00", size)
+	r.body = &chunkReader{store: s, blob: r.id, ids: ids}
+	return r, nil
+}
+
+// chunkReader concatenates the chunks of a blob, each checked against its
+// own id as it is read.
+type chunkReader struct {
+	store *Store
+	blob  string
+	ids   []string
+	cur   *Reader
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.ids) == 0 {
+				return 0, io.EOF
+			}
+			r, err := c.store.Open(c.ids[0])
+			if err != nil {
+				return 0, fmt.Errorf("%w: %s: chunk %s: %v", ErrCorrupt, c.blob, c.ids[0], err)
+			}
+			if r.Type != ChunkType {
+				r.Close()
+				return 0, fmt.Errorf("%w: %s: %s is a %s, not a chunk", ErrCorrupt, c.blob, c.ids[0], r.Type)
+			}
+			c.ids = c.ids[1:]
+			c.cur = r
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() {
+	if c.cur != nil {
+		c.cur.Close()
+	}
+}
@@ -0,0 +1,174 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+)
+
+// testData returns n deterministic pseudo-random bytes, SHA-256 in counter
+// mode, so pinned results do not depend on the Go version.
+func testData(n int, seed uint64) []byte {
+	data := make([]byte, 0, n+sha256.Size)
+	var block [16]byte
+	binary.LittleEndian.PutUint64(block[:8], seed)
+	for i := uint64(0); len(data) < n; i++ {
+		binary.LittleEndian.PutUint64(block[8:], i)
+		sum := sha256.Sum256(block[:])
+		data = append(data, sum[:]...)
+	}
+	return data[:n]
+}
+
+func chunkIDs(t *testing.T, data []byte) []string {
+	t.Helper()
+	ids := []string{}
+	c := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return ids
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, Hash(ChunkType, chunk))
+	}
+}
+
+// TestChunkBoundariesPinned fails when anything moves chunk boundaries:
+// every chunk already stored would stop being shared with new versions.
+func TestChunkBoundariesPinned(t *testing.T) {
+	ids := chunkIDs(t, testData(4<<20, 1))
+	h := sha256.New()
+	for _, id := range ids {
+		io.WriteString(h, id+"\n")
+	}
+	const (
+		wantChunks = 57
+		wantIDs    = "f488bf9722039666c41ed6730c3d4626ebe749d8467cbe455eb217ef084d2896"
+	)
+	if got := hex.EncodeToString(h.Sum(nil)); len(ids) != wantChunks || got != wantIDs {
+		t.Fatalf("4 MiB of test data cut into %d chunks with id list hash %s, want %d and %s",
+			len(ids), got, wantChunks, wantIDs)
+	}
+}
+
+func TestChunksSurviveInsertions(t *testing.T) {
+	data := testData(4<<20, 2)
+	before := map[string]bool{}
+	for _, id := range chunkIDs(t, data) {
+		before[id] = true
+	}
+	insert := testData(100, 3)
+	for _, tc := range []struct {
+		name string
+		at   int
+	}{
+		{"front", 0},
+		{"middle", len(data) / 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			edited := append(append(append([]byte{}, data[:tc.at]...), insert...), data[tc.at:]...)
+			ids := chunkIDs(t, edited)
+			fresh := 0
+			for _, id := range ids {
+				if !before[id] {
+					fresh++
+				}
+			}
+			// Only the chunk holding the insertion, and at most the one
+			// after it while the boundary resynchronises, may change.
+			if fresh > 2 {
+				t.Fatalf("inserting 100 bytes changed %d of %d chunks", fresh, len(ids))
+			}
+		})
+	}
+}
+
+func TestIsChunkedReadsHeaderOnly(t *testing.T) {
+	s := NewStore(t.TempDir())
+	big := testData(1<<20, 4)
+	chunked, err := s.PutChunked(int64(len(big)), bytes.NewReader(big))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := testData(8<<10, 5)
+	whole, err := s.Put("blob", small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Similar enough to the first blob to be packed as a delta of it.
+	similar, err := s.Put("blob", append(small[:len(small):len(small)], 'x'))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(id string, wantChunked bool) {
+		t.Helper()
+		got, err := s.IsChunked(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != wantChunked {
+			t.Fatalf("IsChunked(%s) = %v, want %v", id[:7], got, wantChunked)
+		}
+		objType, err := s.Type(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objType != "blob" {
+			t.Fatalf("Type(%s) = %q, want blob", id[:7], objType)
+		}
+	}
+	check(chunked, true)
+	check(whole, false)
+
+	// Cutting an object short leaves its header readable, and the header
+	// is all that is looked at.
+	damaged, err := s.Put("blob", testData(64<<10, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(s.path(damaged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(s.path(damaged), info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+	check(damaged, false)
+	if _, _, err := s.Get(damaged); err == nil {
+		t.Fatal("reading a truncated object succeeded")
+	}
+
+	_, deltas, err := s.WritePack([]PackCandidate{{ID: whole}, {ID: similar}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deltas != 1 {
+		t.Fatalf("packed %d deltas, want 1", deltas)
+	}
+	for _, id := range []string{whole, similar} {
+		if err := s.RemoveLoose(s.path(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(whole, false)
+	check(similar, false)
+
+	chunks, err := s.Chunks(chunked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := chunkIDs(t, big); len(chunks) != len(want) {
+		t.Fatalf("Chunks = %d ids, want %d", len(chunks), len(want))
+	}
+	if chunks, err := s.Chunks(similar); err != nil || chunks != nil {
+		t.Fatalf("Chunks of a packed blob = %v, %v, want none", chunks, err)
+	}
+}
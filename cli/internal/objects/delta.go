@@ -0,0 +1,139 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+)
+
+// Delta instructions. A delta starts with the uvarint sizes of the source
+// and the target, followed by a sequence of
+//
+//	opCopy   <uvarint offset> <uvarint length>   copy bytes from the source
+//	opInsert <uvarint length> <bytes>            insert literal bytes
+const (
+	opCopy   = 0x01
+	opInsert = 0x02
+
+	deltaBlock = 16
+)
+
+var errBadDelta = errors.New("malformed delta")
+
+func blockKey(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// MakeDelta encodes target as copy/insert instructions against source.
+// Source is indexed in fixed blocks; matches found in the target are
+// extended in both directions before being emitted as copies.
+func MakeDelta(source, target []byte) []byte {
+	var out bytes.Buffer
+	writeUvarint(&out, uint64(len(source)))
+	writeUvarint(&out, uint64(len(target)))
+
+	blocks := map[uint64]int{}
+	for off := 0; off+deltaBlock <= len(source); off += deltaBlock {
+		key := blockKey(source[off : off+deltaBlock])
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = off
+		}
+	}
+
+	insertStart := 0
+	flushInsert := func(end int) {
+		if insertStart < end {
+			n := end - insertStart
+			out.WriteByte(opInsert)
+			writeUvarint(&out, uint64(n))
+			out.Write(target[insertStart:end])
+			insertStart = end
+		}
+	}
+
+	i := 0
+	for i+deltaBlock <= len(target) {
+		off, ok := blocks[blockKey(target[i:i+deltaBlock])]
+		if !ok || !bytes.Equal(source[off:off+deltaBlock], target[i:i+deltaBlock]) {
+			i++
+			continue
+		}
+
+		// Grow the match backwards into pending literal bytes, then
+		// forwards as far as both sides agree.
+		start, srcStart := i, off
+		for start > insertStart && srcStart > 0 && target[start-1] == source[srcStart-1] {
+			start--
+			srcStart--
+		}
+		end, srcEnd := i+deltaBlock, off+deltaBlock
+		for end < len(target) && srcEnd < len(source) && target[end] == source[srcEnd] {
+			end++
+			srcEnd++
+		}
+
+		flushInsert(start)
+		out.WriteByte(opCopy)
+		writeUvarint(&out, uint64(srcStart))
+		writeUvarint(&out, uint64(end-start))
+		insertStart = end
+		i = end
+	}
+	flushInsert(len(target))
+	return out.Bytes()
+}
+
+// ApplyDelta rebuilds the target of a delta made by MakeDelta.
+func ApplyDelta(source, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	srcSize, err := binary.ReadUvarint(r)
+	if err != nil || srcSize != uint64(len(source)) {
+		return nil, errBadDelta
+	}
+	dstSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errBadDelta
+	}
+
+	// The declared size is only trusted as far as the buffer goes: every
+	// op is checked against it, and the target is not allocated up front
+	// beyond what the source and the delta could plausibly make.
+	out := make([]byte, 0, min(dstSize, uint64(len(source)+len(delta))))
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch op {
+		case opCopy:
+			off, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || off > uint64(len(source)) || n > uint64(len(source))-off ||
+				n > dstSize-uint64(len(out)) {
+				return nil, errBadDelta
+			}
+			out = append(out, source[off:off+n]...)
+		case opInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(r.Len()) || n > dstSize-uint64(len(out)) {
+				return nil, errBadDelta
+			}
+			start := len(delta) - r.Len()
+			out = append(out, delta[start:start+int(n)]...)
+			r.Seek(int64(n), io.SeekCurrent)
+		default:
+			return nil, errBadDelta
+		}
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, errBadDelta
+	}
+	return out, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
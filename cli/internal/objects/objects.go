@@ -0,0 +1,517 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("object not found")
+	ErrCorrupt  = errors.New("object is corrupt")
+)
+
+// Store is the content-addressed object database under .drift/objects.
+// Loose objects are stored as zlib("<type> <size>\x00<data>") at a path
+// derived from the SHA-256 of the uncompressed bytes; objects that have
+// been repacked live in pack files under .drift/objects/pack.
+type Store struct {
+	dir   string
+	packs []*Pack
+}
+
+func NewStore(repoRoot string) *Store {
+	return &Store{dir: filepath.Join(repoRoot, ".drift", "objects")}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Hash returns the object id data would be stored under.
+func Hash(objType string, data []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %d\x00", objType, len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFile returns the blob id of the file at path, streaming its content
+// instead of loading it into memory.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "blob %d\x00", info.Size())
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	if n != info.Size() {
+		return "", fmt.Errorf("%s changed size while being read", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash[2:])
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Put stores data as an object of objType and returns its id. Writing an
+// object that already exists is a no-op.
+func (s *Store) Put(objType string, data []byte) (string, error) {
+	id := Hash(objType, data)
+	if s.Has(id) {
+		return id, nil
+	}
+
+	encoded, err := compressObject(id, objType, data)
+	if err != nil {
+		return "", err
+	}
+	if err := s.writeFile(id, encoded); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// compressObject returns the loose file content of an object.
+func compressObject(id, objType string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	fmt.Fprintf(w, "%s %d\x00", objType, len(data))
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing object %s: %v", id, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing object %s: %v", id, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PutStream stores size bytes read from r as an object of objType and
+// returns its id. The content is hashed and compressed in a single pass
+// into a temporary file, so memory use does not grow with the object.
+func (s *Store) PutStream(objType string, size int64, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating object directory %s: %v", s.dir, err)
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp-obj-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary object: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	buffered := bufio.NewWriter(tmp)
+	zw := zlib.NewWriter(buffered)
+	h := sha256.New()
+	w := io.MultiWriter(h, zw)
+	fmt.Fprintf(w, "%s %d\x00", objType, size)
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return "", fmt.Errorf("error writing object: %v", err)
+	}
+	if n != size {
+		return "", fmt.Errorf("expected %d bytes but read %d; was the file changed while being added?", size, n)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("error compressing object: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return "", fmt.Errorf("error writing object: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("error writing object: %v", err)
+	}
+
+	id := hex.EncodeToString(h.Sum(nil))
+	if s.Has(id) {
+		return id, nil
+	}
+	dir := filepath.Join(s.dir, id[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating object directory %s: %v", dir, err)
+	}
+	os.Chmod(tmp.Name(), 0444)
+	if err := os.Rename(tmp.Name(), s.path(id)); err != nil {
+		return "", fmt.Errorf("error renaming object %s: %v", id, err)
+	}
+	committed = true
+	return id, nil
+}
+
+// writeFile writes an already encoded object through a temporary file so
+// that a crash never leaves a partial object under its final name.
+func (s *Store) writeFile(id string, encoded []byte) error {
+	dir := filepath.Join(s.dir, id[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating object directory %s: %v", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "tmp-obj-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary object: %v", err)
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing object %s: %v", id, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing object %s: %v", id, err)
+	}
+	os.Chmod(tmp.Name(), 0444)
+	if err := os.Rename(tmp.Name(), s.path(id)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error renaming object %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *Store) Has(hash string) bool {
+	if !validHash(hash) {
+		return false
+	}
+	if _, err := os.Stat(s.path(hash)); err == nil {
+		return true
+	}
+	p, _, err := s.findPacked(hash)
+	return err == nil && p != nil
+}
+
+// FindPrefix returns the ids of every object, loose or packed, whose id
+// starts with the hex string prefix.
+func (s *Store) FindPrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 2 {
+		return nil, fmt.Errorf("object id prefix %q is too short", prefix)
+	}
+	found := map[string]bool{}
+
+	dir := filepath.Join(s.dir, prefix[:2])
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	for _, e := range entries {
+		id := prefix[:2] + e.Name()
+		if validHash(id) && strings.HasPrefix(id, prefix) {
+			found[id] = true
+		}
+	}
+
+	packs, err := s.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		ids := p.IDs()
+		for i := sort.SearchStrings(ids, prefix); i < len(ids) && strings.HasPrefix(ids[i], prefix); i++ {
+			found[ids[i]] = true
+		}
+	}
+
+	matches := make([]string, 0, len(found))
+	for id := range found {
+		matches = append(matches, id)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Get reads a whole object and returns its type and content.
+func (s *Store) Get(hash string) (string, []byte, error) {
+	r, err := s.Open(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.Type, data, nil
+}
+
+// Reader streams the content of an object. The hash of the object is
+// checked once the content has been read to the end, and Read reports
+// ErrCorrupt instead of io.EOF on mismatch.
+type Reader struct {
+	Type string
+	Size int64
+
+	id     string
+	file   *os.File
+	zr     io.ReadCloser
+	body   io.Reader
+	hasher hash.Hash
+	read   int64
+	chunks []string
+}
+
+// Open starts streaming an object.
+func (s *Store) Open(hash string) (*Reader, error) {
+	if !validHash(hash) {
+		return nil, fmt.Errorf("invalid object id %q", hash)
+	}
+	f, err := os.Open(s.path(hash))
+	if os.IsNotExist(err) {
+		return s.OpenPacked(hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening object %s: %v", hash, err)
+	}
+
+	r := &Reader{id: hash, file: f}
+	hdr, objType, size, br, err := r.readHeader()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if objType == chunkedType {
+		return s.openChunked(r, size, br)
+	}
+
+	r.Type = objType
+	r.Size = size
+	r.hasher = sha256.New()
+	r.hasher.Write([]byte(hdr))
+	r.body = br
+	return r, nil
+}
+
+// Type returns the type of an object from its header, without reading
+// its content.
+func (s *Store) Type(hash string) (string, error) {
+	objType, err := s.storedType(hash)
+	if objType == chunkedType {
+		objType = "blob"
+	}
+	return objType, err
+}
+
+// storedType returns the type an object is stored under, which is
+// "chunked" for chunked blobs. Packs only ever hold objects whole.
+func (s *Store) storedType(hash string) (string, error) {
+	if !validHash(hash) {
+		return "", fmt.Errorf("invalid object id %q", hash)
+	}
+	f, err := os.Open(s.path(hash))
+	if os.IsNotExist(err) {
+		objType, ok, err := s.packedType(hash, 0)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: %s", ErrNotFound, hash)
+		}
+		return objType, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("error opening object %s: %v", hash, err)
+	}
+	r := &Reader{id: hash, file: f}
+	defer r.Close()
+	_, objType, _, _, err := r.readHeader()
+	return objType, err
+}
+
+// readHeader reads the header of the loose object r.file holds and returns
+// it raw and parsed, with a reader positioned at the content.
+func (r *Reader) readHeader() (hdr, objType string, size int64, br *bufio.Reader, err error) {
+	br = bufio.NewReader(r.file)
+	magic, _ := br.Peek(2)
+	if isZlib(magic) {
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return "", "", 0, nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, r.id, err)
+		}
+		r.zr = zr
+		br = bufio.NewReader(zr)
+	}
+	// Objects without a zlib header were written raw by older versions of
+	// drift and are still readable.
+
+	hdr, err = br.ReadString(0)
+	if err != nil {
+		return "", "", 0, nil, fmt.Errorf("%w: %s: missing header", ErrCorrupt, r.id)
+	}
+	objType, sizeStr, ok := strings.Cut(strings.TrimSuffix(hdr, "\x00"), " ")
+	size, err = strconv.ParseInt(sizeStr, 10, 64)
+	if !ok || err != nil || size < 0 {
+		return "", "", 0, nil, fmt.Errorf("%w: %s: malformed header %q", ErrCorrupt, r.id, hdr)
+	}
+	return hdr, objType, size, br, nil
+}
+
+// OpenPacked streams an object from the packs, ignoring any loose copy.
+// Open falls back to it once the loose lookup misses.
+func (s *Store) OpenPacked(hash string) (*Reader, error) {
+	objType, data, ok, err := s.readPacked(hash, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+	r := &Reader{
+		Type:   objType,
+		Size:   int64(len(data)),
+		id:     hash,
+		body:   bytes.NewReader(data),
+		hasher: sha256.New(),
+	}
+	fmt.Fprintf(r.hasher, "%s %d\x00", objType, len(data))
+	return r, nil
+}
+
+func isZlib(b []byte) bool {
+	return len(b) == 2 && b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hasher.Write(p[:n])
+	r.read += int64(n)
+	if r.read > r.Size {
+		return n, fmt.Errorf("%w: %s: content longer than header size", ErrCorrupt, r.id)
+	}
+	if err == io.EOF {
+		if r.read != r.Size {
+			return n, fmt.Errorf("%w: %s: content shorter than header size", ErrCorrupt, r.id)
+		}
+		if hex.EncodeToString(r.hasher.Sum(nil)) != r.id {
+			return n, fmt.Errorf("%w: %s: hash mismatch", ErrCorrupt, r.id)
+		}
+	}
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	if c, ok := r.body.(*chunkReader); ok {
+		c.Close()
+	}
+	if r.zr != nil {
+		r.zr.Close()
+	}
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// LooseObject describes an object file under .drift/objects/xx/.
+type LooseObject struct {
+	Hash    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Loose lists every loose object in the store. Files that are not named
+// like objects, such as interrupted temporary writes in a fan-out directory
+// or the top one, are returned separately as garbage.
+func (s *Store) Loose() ([]LooseObject, []LooseObject, error) {
+	objs := []LooseObject{}
+	garbage := []LooseObject{}
+
+	dirs, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return objs, garbage, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %v", s.dir, err)
+	}
+	for _, d := range dirs {
+		// PutStream writes in the top directory, as the object's id is
+		// not known until the content has been read.
+		if !d.IsDir() && strings.HasPrefix(d.Name(), "tmp-obj-") {
+			info, err := d.Info()
+			if err != nil {
+				continue
+			}
+			garbage = append(garbage, LooseObject{
+				Path:    filepath.Join(s.dir, d.Name()),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+			continue
+		}
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		if _, err := hex.DecodeString(d.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(s.dir, d.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading %s: %v", dir, err)
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			obj := LooseObject{
+				Hash:    d.Name() + f.Name(),
+				Path:    filepath.Join(dir, f.Name()),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			}
+			if validHash(obj.Hash) {
+				objs = append(objs, obj)
+			} else {
+				obj.Hash = ""
+				garbage = append(garbage, obj)
+			}
+		}
+	}
+	return objs, garbage, nil
+}
+
+// RemoveLoose deletes a loose object file, and its fan-out directory if
+// that becomes empty.
+func (s *Store) RemoveLoose(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %v", path, err)
+	}
+	if dir := filepath.Dir(path); dir != s.dir {
+		os.Remove(dir)
+	}
+	return nil
+}
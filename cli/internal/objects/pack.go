@@ -0,0 +1,660 @@
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A pack file stores many objects in one file:
+//
+//	"DPCK" <uint32 version> <uint32 count>
+//	entries...
+//	<sha256 of everything above>
+//
+// Each entry is either a full object
+//
+//	0x01 <uvarint len(type)> <type> <uvarint size> <zlib(data)>
+//
+// or a delta against another object of the same pack
+//
+//	0x02 <32-byte base id> <uvarint size> <zlib(delta)>
+//
+// The matching .idx file lists the object ids sorted, each with the offset
+// of its entry:
+//
+//	"DIDX" <uint32 version> <uint32 count>
+//	(<32-byte id> <uint64 offset>)...
+//	<32-byte pack checksum> <sha256 of everything above>
+const (
+	packMagic   = "DPCK"
+	idxMagic    = "DIDX"
+	packVersion = 1
+
+	entryFull  = 0x01
+	entryDelta = 0x02
+
+	// maxDeltaDepth bounds delta chains so reading an object never has to
+	// apply more than this many deltas.
+	maxDeltaDepth = 10
+	// deltaWindow is how many preceding candidates each object is tried
+	// against when repacking.
+	deltaWindow = 10
+	// maxDeltaSize keeps very large objects out of delta search; they are
+	// packed whole.
+	maxDeltaSize = 32 << 20
+	// maxChainLookups guards against cyclic or corrupt delta chains.
+	maxChainLookups = 64
+)
+
+// Pack is an open pack file and its index.
+type Pack struct {
+	Name     string
+	path     string
+	ids      []string
+	offsets  []uint64
+	checksum []byte
+}
+
+func (s *Store) packDir() string {
+	return filepath.Join(s.dir, "pack")
+}
+
+// Packs returns every pack in the store, loading their indexes on first
+// use.
+func (s *Store) Packs() ([]*Pack, error) {
+	if s.packs != nil {
+		return s.packs, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(s.packDir(), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	packs := []*Pack{}
+	for _, idxPath := range matches {
+		p, err := readPackIndex(idxPath)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	s.packs = packs
+	return packs, nil
+}
+
+func readPackIndex(idxPath string) (*Pack, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pack index %s: %v", idxPath, err)
+	}
+	corrupt := fmt.Errorf("%w: pack index %s", ErrCorrupt, filepath.Base(idxPath))
+	if len(data) < 12+64 || string(data[:4]) != idxMagic {
+		return nil, corrupt
+	}
+	sum := sha256.Sum256(data[:len(data)-32])
+	if !bytes.Equal(sum[:], data[len(data)-32:]) {
+		return nil, corrupt
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != packVersion {
+		return nil, fmt.Errorf("unsupported pack index version in %s", idxPath)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	if len(data) != 12+count*40+64 {
+		return nil, corrupt
+	}
+
+	p := &Pack{
+		Name:     strings.TrimSuffix(filepath.Base(idxPath), ".idx"),
+		path:     strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		ids:      make([]string, count),
+		offsets:  make([]uint64, count),
+		checksum: data[len(data)-64 : len(data)-32],
+	}
+	for i := 0; i < count; i++ {
+		rec := data[12+i*40 : 12+(i+1)*40]
+		p.ids[i] = hex.EncodeToString(rec[:32])
+		p.offsets[i] = binary.BigEndian.Uint64(rec[32:])
+	}
+	return p, nil
+}
+
+// IDs returns the ids of every object in the pack, sorted.
+func (p *Pack) IDs() []string {
+	return p.ids
+}
+
+func (p *Pack) Path() string {
+	return p.path
+}
+
+// Verify checks the pack header and trailing checksum against its index.
+// It does not decode the entries; read them through OpenPacked for that.
+func (p *Pack) Verify() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return fmt.Errorf("error opening pack %s: %v", p.Name, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading pack %s: %v", p.Name, err)
+	}
+	if info.Size() < 12+32 {
+		return fmt.Errorf("%w: pack %s is truncated", ErrCorrupt, p.Name)
+	}
+
+	var hdr [12]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return fmt.Errorf("error reading pack %s: %v", p.Name, err)
+	}
+	if string(hdr[:4]) != packMagic || binary.BigEndian.Uint32(hdr[4:8]) != packVersion {
+		return fmt.Errorf("%w: pack %s has a bad header", ErrCorrupt, p.Name)
+	}
+	if int(binary.BigEndian.Uint32(hdr[8:12])) != len(p.ids) {
+		return fmt.Errorf("%w: pack %s object count does not match its index", ErrCorrupt, p.Name)
+	}
+
+	h := sha256.New()
+	h.Write(hdr[:])
+	if _, err := io.CopyN(h, f, info.Size()-12-32); err != nil {
+		return fmt.Errorf("error reading pack %s: %v", p.Name, err)
+	}
+	var trailer [32]byte
+	if _, err := io.ReadFull(f, trailer[:]); err != nil {
+		return fmt.Errorf("error reading pack %s: %v", p.Name, err)
+	}
+	sum := h.Sum(nil)
+	if !bytes.Equal(sum, trailer[:]) || !bytes.Equal(sum, p.checksum) {
+		return fmt.Errorf("%w: pack %s checksum mismatch", ErrCorrupt, p.Name)
+	}
+	return nil
+}
+
+// StrayPackFiles lists files in the pack directory that are not a pack or
+// its index, such as temporaries left by an interrupted repack, and packs
+// missing their counterpart.
+func (s *Store) StrayPackFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.packDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", s.packDir(), err)
+	}
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+	stray := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+		switch {
+		case ext == ".pack" && strings.HasPrefix(name, "pack-") && names[base+".idx"]:
+		case ext == ".idx" && strings.HasPrefix(name, "pack-") && names[base+".pack"]:
+		default:
+			stray = append(stray, filepath.Join(s.packDir(), name))
+		}
+	}
+	return stray, nil
+}
+
+func (p *Pack) find(id string) (uint64, bool) {
+	i := sort.SearchStrings(p.ids, id)
+	if i < len(p.ids) && p.ids[i] == id {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// findPacked returns the pack holding id, if any.
+func (s *Store) findPacked(id string) (*Pack, uint64, error) {
+	packs, err := s.Packs()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, p := range packs {
+		if off, ok := p.find(id); ok {
+			return p, off, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// readPacked reads an object from the packs, resolving delta chains.
+func (s *Store) readPacked(id string, lookups int) (string, []byte, bool, error) {
+	if lookups > maxChainLookups {
+		return "", nil, false, fmt.Errorf("%w: delta chain for %s is too deep", ErrCorrupt, id)
+	}
+	p, off, err := s.findPacked(id)
+	if err != nil || p == nil {
+		return "", nil, false, err
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("error opening pack %s: %v", p.Name, err)
+	}
+	defer f.Close()
+	corrupt := func(what string) error {
+		return fmt.Errorf("%w: %s in %s: %s", ErrCorrupt, id, p.Name, what)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, false, fmt.Errorf("error reading pack %s: %v", p.Name, err)
+	}
+	// The entry can extend at most to the trailing checksum.
+	end := info.Size() - sha256.Size
+	if int64(off) >= end {
+		return "", nil, false, corrupt("entry offset is past the end of the pack")
+	}
+	extent := end - int64(off)
+	br := bufio.NewReader(io.NewSectionReader(f, int64(off), extent))
+
+	kind, err := br.ReadByte()
+	if err != nil {
+		return "", nil, false, corrupt("truncated entry")
+	}
+	switch kind {
+	case entryFull:
+		typeLen, err := binary.ReadUvarint(br)
+		if err != nil || typeLen > 32 {
+			return "", nil, false, corrupt("bad type")
+		}
+		typeBuf := make([]byte, typeLen)
+		if _, err := io.ReadFull(br, typeBuf); err != nil {
+			return "", nil, false, corrupt("bad type")
+		}
+		data, err := readZlibSized(br, extent)
+		if err != nil {
+			return "", nil, false, corrupt(err.Error())
+		}
+		return string(typeBuf), data, true, nil
+
+	case entryDelta:
+		var base [32]byte
+		if _, err := io.ReadFull(br, base[:]); err != nil {
+			return "", nil, false, corrupt("truncated delta base")
+		}
+		delta, err := readZlibSized(br, extent)
+		if err != nil {
+			return "", nil, false, corrupt(err.Error())
+		}
+		baseType, baseData, ok, err := s.readPacked(hex.EncodeToString(base[:]), lookups+1)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if !ok {
+			return "", nil, false, corrupt("missing delta base")
+		}
+		data, err := ApplyDelta(baseData, delta)
+		if err != nil {
+			return "", nil, false, corrupt(err.Error())
+		}
+		return baseType, data, true, nil
+	}
+	return "", nil, false, corrupt("unknown entry kind")
+}
+
+// packedType returns the type of a packed object from its entry header,
+// following delta bases without inflating anything.
+func (s *Store) packedType(id string, lookups int) (string, bool, error) {
+	if lookups > maxChainLookups {
+		return "", false, fmt.Errorf("%w: delta chain for %s is too deep", ErrCorrupt, id)
+	}
+	p, off, err := s.findPacked(id)
+	if err != nil || p == nil {
+		return "", false, err
+	}
+	f, err := os.Open(p.path)
+	if err != nil {
+		return "", false, fmt.Errorf("error opening pack %s: %v", p.Name, err)
+	}
+	defer f.Close()
+	corrupt := func(what string) error {
+		return fmt.Errorf("%w: %s in %s: %s", ErrCorrupt, id, p.Name, what)
+	}
+	// A header is a few dozen bytes; the entry is read no further.
+	br := bufio.NewReaderSize(io.NewSectionReader(f, int64(off), 64), 64)
+	kind, err := br.ReadByte()
+	if err != nil {
+		return "", false, corrupt("truncated entry")
+	}
+	switch kind {
+	case entryFull:
+		typeLen, err := binary.ReadUvarint(br)
+		if err != nil || typeLen > 32 {
+			return "", false, corrupt("bad type")
+		}
+		typeBuf := make([]byte, typeLen)
+		if _, err := io.ReadFull(br, typeBuf); err != nil {
+			return "", false, corrupt("bad type")
+		}
+		return string(typeBuf), true, nil
+	case entryDelta:
+		var base [32]byte
+		if _, err := io.ReadFull(br, base[:]); err != nil {
+			return "", false, corrupt("truncated delta base")
+		}
+		objType, ok, err := s.packedType(hex.EncodeToString(base[:]), lookups+1)
+		if err == nil && !ok {
+			err = corrupt("missing delta base")
+		}
+		return objType, ok, err
+	}
+	return "", false, corrupt("unknown entry kind")
+}
+
+// maxDeflateRatio is the most deflate can compress data by, so an entry
+// of n bytes cannot decompress to more than n*maxDeflateRatio.
+const maxDeflateRatio = 1032
+
+// readZlibSized reads a size-prefixed zlib stream from an entry at most
+// extent bytes long. The declared size is not trusted for allocation: the
+// buffer starts at a small multiple of the entry and grows only as data
+// actually decompresses, up to the declared size.
+func readZlibSized(br *bufio.Reader, extent int64) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("bad size")
+	}
+	if size > uint64(extent)*maxDeflateRatio {
+		return nil, fmt.Errorf("declared size %d does not fit in the pack", size)
+	}
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("bad compressed data")
+	}
+	defer zr.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, min(size, uint64(extent)*4)))
+	n, err := io.Copy(buf, io.LimitReader(zr, int64(size)))
+	if err != nil || uint64(n) != size {
+		return nil, fmt.Errorf("truncated data")
+	}
+	return buf.Bytes(), nil
+}
+
+// PackCandidate is an object to include in a new pack. NameHint (usually
+// the path the object was last seen at) groups similar objects together
+// when choosing delta bases.
+type PackCandidate struct {
+	ID       string
+	NameHint string
+
+	objType string
+	size    int64
+}
+
+type packWriter struct {
+	w      io.Writer
+	hasher hash.Hash
+	offset uint64
+}
+
+func (pw *packWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.hasher.Write(b[:n])
+	pw.offset += uint64(n)
+	return n, err
+}
+
+type windowEntry struct {
+	id      string
+	objType string
+	data    []byte
+	depth   int
+}
+
+// WritePack writes the candidates into a new pack and returns its name and
+// how many objects were stored as deltas. Candidates are ordered by type,
+// name hint and size so that versions of the same file sit next to each
+// other, and each object is delta-encoded against the best of the
+// preceding deltaWindow objects when that saves at least half its size.
+func (s *Store) WritePack(candidates []PackCandidate) (string, int, error) {
+	for i := range candidates {
+		r, err := s.Open(candidates[i].ID)
+		if err != nil {
+			return "", 0, err
+		}
+		candidates[i].objType = r.Type
+		candidates[i].size = r.Size
+		r.Close()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.objType != b.objType {
+			return a.objType < b.objType
+		}
+		if a.NameHint != b.NameHint {
+			return a.NameHint < b.NameHint
+		}
+		return a.size > b.size
+	})
+
+	if err := os.MkdirAll(s.packDir(), 0755); err != nil {
+		return "", 0, fmt.Errorf("error creating pack directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(s.packDir(), "tmp-pack-")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating pack: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bw := bufio.NewWriter(tmp)
+	pw := &packWriter{w: bw, hasher: sha256.New()}
+	var hdr [12]byte
+	copy(hdr[:4], packMagic)
+	binary.BigEndian.PutUint32(hdr[4:8], packVersion)
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(candidates)))
+	pw.Write(hdr[:])
+
+	offsets := map[string]uint64{}
+	window := []windowEntry{}
+	deltas := 0
+	for _, c := range candidates {
+		offsets[c.ID] = pw.offset
+
+		if c.size > maxDeltaSize {
+			if err := s.writeFullStreaming(pw, c); err != nil {
+				return "", 0, err
+			}
+			continue
+		}
+
+		_, data, err := s.Get(c.ID)
+		if err != nil {
+			return "", 0, err
+		}
+
+		var best *windowEntry
+		var bestDelta []byte
+		for i := range window {
+			base := &window[i]
+			if base.objType != c.objType || base.depth >= maxDeltaDepth {
+				continue
+			}
+			d := MakeDelta(base.data, data)
+			if len(d) < len(data)/2 && (bestDelta == nil || len(d) < len(bestDelta)) {
+				best, bestDelta = base, d
+			}
+		}
+
+		entry := windowEntry{id: c.ID, objType: c.objType, data: data}
+		if best != nil {
+			entry.depth = best.depth + 1
+			deltas++
+			raw, _ := hex.DecodeString(best.id)
+			pw.Write([]byte{entryDelta})
+			pw.Write(raw)
+			if err := writeZlibSized(pw, bestDelta); err != nil {
+				return "", 0, err
+			}
+		} else {
+			if err := writeFullHeader(pw, c.objType); err != nil {
+				return "", 0, err
+			}
+			if err := writeZlibSized(pw, data); err != nil {
+				return "", 0, err
+			}
+		}
+
+		window = append(window, entry)
+		if len(window) > deltaWindow {
+			window = window[1:]
+		}
+	}
+
+	checksum := pw.hasher.Sum(nil)
+	bw.Write(checksum)
+	if err := bw.Flush(); err != nil {
+		return "", 0, fmt.Errorf("error writing pack: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", 0, fmt.Errorf("error writing pack: %v", err)
+	}
+	tmp.Close()
+
+	name := "pack-" + hex.EncodeToString(checksum)
+	packPath := filepath.Join(s.packDir(), name+".pack")
+	if err := os.Rename(tmp.Name(), packPath); err != nil {
+		return "", 0, fmt.Errorf("error renaming pack: %v", err)
+	}
+	if err := writePackIndex(filepath.Join(s.packDir(), name+".idx"), offsets, checksum); err != nil {
+		return "", 0, err
+	}
+	s.packs = nil
+	return name, deltas, nil
+}
+
+func writeFullHeader(w io.Writer, objType string) error {
+	var buf bytes.Buffer
+	buf.WriteByte(entryFull)
+	writeUvarint(&buf, uint64(len(objType)))
+	buf.WriteString(objType)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeZlibSized(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(data)))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(w)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeFullStreaming packs a large object without holding it in memory.
+func (s *Store) writeFullStreaming(w io.Writer, c PackCandidate) error {
+	r, err := s.Open(c.ID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := writeFullHeader(w, c.objType); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(r.Size))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(w)
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writePackIndex(path string, offsets map[string]uint64, packChecksum []byte) error {
+	ids := make([]string, 0, len(offsets))
+	for id := range offsets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buf bytes.Buffer
+	var hdr [12]byte
+	copy(hdr[:4], idxMagic)
+	binary.BigEndian.PutUint32(hdr[4:8], packVersion)
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(ids)))
+	buf.Write(hdr[:])
+	for _, id := range ids {
+		raw, _ := hex.DecodeString(id)
+		buf.Write(raw)
+		var off [8]byte
+		binary.BigEndian.PutUint64(off[:], offsets[id])
+		buf.Write(off[:])
+	}
+	buf.Write(packChecksum)
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0444); err != nil {
+		return fmt.Errorf("error writing pack index: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error renaming pack index: %v", err)
+	}
+	return nil
+}
+
+// RemovePack deletes a pack and its index.
+// Loosen writes the packed object id back as a loose object dated modTime,
+// so that gc ages it out like any other loose object. An object that is
+// already loose is left as it is.
+func (s *Store) Loosen(id string, modTime time.Time) error {
+	if _, err := os.Stat(s.path(id)); err == nil {
+		return nil
+	}
+	objType, data, ok, err := s.readPacked(id, 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("object %s is not packed", id)
+	}
+	encoded, err := compressObject(id, objType, data)
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(id, encoded); err != nil {
+		return err
+	}
+	if err := os.Chtimes(s.path(id), modTime, modTime); err != nil {
+		return fmt.Errorf("error dating object %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *Store) RemovePack(p *Pack) error {
+	idxPath := strings.TrimSuffix(p.path, ".pack") + ".idx"
+	if err := os.Remove(idxPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %v", idxPath, err)
+	}
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %v", p.path, err)
+	}
+	s.packs = nil
+	return nil
+}
@@ -0,0 +1,188 @@
+package refs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/lockfile"
+)
+
+// packedRefsHeader starts .drift/packed-refs. Each following line is
+// "<object id> <ref name>", sorted by name.
+const packedRefsHeader = "# pack-refs with: sorted\n"
+
+// packedCache holds the last packed-refs file parsed, so that reading many
+// refs from a repository with thousands of packed tags parses it once.
+var packedCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	refs    map[string]string
+}
+
+func packedPath(repoRoot string) string {
+	return refPath(repoRoot, "packed-refs")
+}
+
+// readPacked returns the refs stored in .drift/packed-refs. The returned
+// map is shared and must not be modified.
+func readPacked(repoRoot string) (map[string]string, error) {
+	path := packedPath(repoRoot)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packed-refs: %v", err)
+	}
+
+	packedCache.Lock()
+	defer packedCache.Unlock()
+	if packedCache.path == path && packedCache.modTime.Equal(info.ModTime()) && packedCache.size == info.Size() {
+		return packedCache.refs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packed-refs: %v", err)
+	}
+	refs := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed packed-refs line: %q", line)
+		}
+		refs[name] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read packed-refs: %v", err)
+	}
+
+	packedCache.path = path
+	packedCache.modTime = info.ModTime()
+	packedCache.size = info.Size()
+	packedCache.refs = refs
+	return refs, nil
+}
+
+// writePacked writes refs through the packed-refs lock.
+func writePacked(lock *lockfile.Lock, refs map[string]string) error {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString(packedRefsHeader)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s %s\n", refs[name], name)
+	}
+	if err := lock.Write(buf.Bytes()); err != nil {
+		lock.Rollback()
+		return err
+	}
+	err := lock.Commit()
+
+	// A rewrite can keep the size and, on coarse clocks, the mtime.
+	packedCache.Lock()
+	packedCache.path = ""
+	packedCache.Unlock()
+	return err
+}
+
+// removePacked drops name from packed-refs, if it is there, through the
+// packed-refs lock the caller holds.
+func removePacked(repoRoot string, lock *lockfile.Lock, name string) error {
+	packed, err := readPacked(repoRoot)
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	if _, ok := packed[name]; !ok {
+		lock.Rollback()
+		return nil
+	}
+	kept := make(map[string]string, len(packed))
+	for n, hash := range packed {
+		if n != name {
+			kept[n] = hash
+		}
+	}
+	return writePacked(lock, kept)
+}
+
+// Pack moves loose refs below prefix into packed-refs and returns how many
+// it packed. A loose ref that changes while it is being packed stays loose,
+// and so keeps its newer value.
+func Pack(repoRoot, prefix string) (int, error) {
+	names, err := List(repoRoot, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	lock, err := lockfile.Acquire(packedPath(repoRoot))
+	if err != nil {
+		return 0, fmt.Errorf("cannot lock packed-refs: %w", err)
+	}
+	packed, err := readPacked(repoRoot)
+	if err != nil {
+		lock.Rollback()
+		return 0, err
+	}
+	refs := make(map[string]string, len(packed)+len(names))
+	for name, hash := range packed {
+		refs[name] = hash
+	}
+	loose := map[string]string{}
+	for _, rel := range names {
+		name := prefix + rel
+		data, err := os.ReadFile(refPath(repoRoot, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			lock.Rollback()
+			return 0, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		hash := strings.TrimSpace(string(data))
+		refs[name] = hash
+		loose[name] = hash
+	}
+	if len(loose) == 0 {
+		lock.Rollback()
+		return 0, nil
+	}
+	if err := writePacked(lock, refs); err != nil {
+		return 0, err
+	}
+
+	// The packed copies are in place; drop the loose files that still
+	// hold the packed value.
+	for name, hash := range loose {
+		refLock, err := lockfile.Acquire(refPath(repoRoot, name))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(refPath(repoRoot, name))
+		if err == nil && strings.TrimSpace(string(data)) == hash {
+			os.Remove(refPath(repoRoot, name))
+		}
+		refLock.Rollback()
+		removeEmptyDirs(filepath.Dir(refPath(repoRoot, name)), namespaceDir(repoRoot, name))
+	}
+	return len(loose), nil
+}
@@ -0,0 +1,221 @@
+// Package refs reads and updates the refs under .drift. Every update takes
+// the ref's lock file, checks that the ref still holds the value the
+// caller last saw, and moves the new value into place with an fsync and a
+// rename, so concurrent drift processes cannot silently overwrite each
+// other's work.
+//
+// Refs are stored loose, one file per ref, or in .drift/packed-refs. A
+// loose ref always wins over a packed one of the same name.
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/lockfile"
+)
+
+// ErrStale means a ref no longer held the value an update expected:
+// another process moved it in between.
+var ErrStale = errors.New("ref was updated concurrently")
+
+func refPath(repoRoot, name string) string {
+	return filepath.Join(repoRoot, ".drift", filepath.FromSlash(name))
+}
+
+// Read returns the object id stored in name (e.g. "refs/heads/main"), or
+// "" if the ref does not exist. Reading "HEAD" returns its raw content.
+func Read(repoRoot, name string) (string, error) {
+	data, err := os.ReadFile(refPath(repoRoot, name))
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) && !isDir(refPath(repoRoot, name)) {
+		return "", fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	packed, err := readPacked(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return packed[name], nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// List returns the names of all loose and packed refs below prefix (e.g.
+// "refs/heads/"), relative to prefix and sorted.
+func List(repoRoot, prefix string) ([]string, error) {
+	seen := map[string]bool{}
+	root := refPath(repoRoot, prefix)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		seen[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+	}
+
+	packed, err := readPacked(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	for name := range packed {
+		if strings.HasPrefix(name, prefix) {
+			seen[strings.TrimPrefix(name, prefix)] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func staleError(name, current, expected string) error {
+	describe := func(hash string) string {
+		if hash == "" {
+			return "nothing"
+		}
+		return hash
+	}
+	return fmt.Errorf(
+		"cannot update ref '%s': it is at %s but %s was expected: %w",
+		name, describe(current), describe(expected), ErrStale,
+	)
+}
+
+// Update points name at newHash, provided it still holds oldHash ("" when
+// the ref must not exist yet). The ref is locked while it is checked and
+// written, and the new value reaches the disk before it replaces the old.
+// Updating "HEAD" this way detaches it.
+func Update(repoRoot, name, newHash, oldHash string) error {
+	path := refPath(repoRoot, name)
+	if isDir(path) {
+		return fmt.Errorf("cannot update ref '%s': there is a directory in the way", name)
+	}
+	lock, err := lockfile.Acquire(path)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+	current, err := Read(repoRoot, name)
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	if current != oldHash {
+		lock.Rollback()
+		return staleError(name, current, oldHash)
+	}
+	if err := lock.Write([]byte(newHash + "\n")); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// Delete removes name, loose and packed, provided it still holds oldHash.
+func Delete(repoRoot, name, oldHash string) error {
+	path := refPath(repoRoot, name)
+	lock, err := lockfile.Acquire(path)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+	err = deleteLocked(repoRoot, name, oldHash)
+	lock.Rollback()
+	if err != nil {
+		return err
+	}
+	removeEmptyDirs(filepath.Dir(path), namespaceDir(repoRoot, name))
+	return nil
+}
+
+func deleteLocked(repoRoot, name, oldHash string) error {
+	current, err := Read(repoRoot, name)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return fmt.Errorf("cannot delete ref '%s': it does not exist", name)
+	}
+	if current != oldHash {
+		return staleError(name, current, oldHash)
+	}
+
+	// Take the packed-refs lock before removing the loose file, so that a
+	// concurrent Pack cannot copy the ref into packed-refs behind our back.
+	packedLock, err := lockfile.Acquire(packedPath(repoRoot))
+	if err != nil {
+		return fmt.Errorf("cannot lock packed-refs: %w", err)
+	}
+	if err := os.Remove(refPath(repoRoot, name)); err != nil && !os.IsNotExist(err) {
+		packedLock.Rollback()
+		return fmt.Errorf("failed to delete %s: %v", name, err)
+	}
+	return removePacked(repoRoot, packedLock, name)
+}
+
+// SetHead points HEAD at a ref, or detaches it at a commit when target is
+// an object id. The old value is not checked.
+func SetHead(repoRoot, target string) error {
+	content := target + "\n"
+	if strings.HasPrefix(target, "refs/") {
+		content = "ref: " + content
+	}
+	lock, err := lockfile.Acquire(refPath(repoRoot, "HEAD"))
+	if err != nil {
+		return fmt.Errorf("cannot lock HEAD: %w", err)
+	}
+	if err := lock.Write([]byte(content)); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return fmt.Errorf("failed to update HEAD: %v", err)
+	}
+	return nil
+}
+
+// namespaceDir is the directory of the namespace name lives in, such as
+// .drift/refs/heads, which is kept even when it has no loose refs left.
+func namespaceDir(repoRoot, name string) string {
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) < 3 {
+		return refPath(repoRoot, "refs")
+	}
+	return refPath(repoRoot, parts[0]+"/"+parts[1])
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty,
+// stopping at stop.
+func removeEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sammanbajracharya/drift_cli/internal/media"
+	"gopkg.in/ini.v1"
+)
+
+var chunkThresholds sync.Map
+
+// ChunkThreshold returns core.chunkThreshold from the repository config:
+// blobs at least this large are stored as content-defined chunks, which
+// later versions of the file share. Zero, the default, stores every blob
+// whole. The value is read once per process.
+func ChunkThreshold(repoRoot string) (int64, error) {
+	if v, ok := chunkThresholds.Load(repoRoot); ok {
+		return v.(int64), nil
+	}
+	cfg, err := ini.LooseLoad(filepath.Join(repoRoot, ".drift", "config"))
+	if err != nil {
+		return 0, fmt.Errorf("error loading config: %v", err)
+	}
+	var threshold int64
+	if value := strings.TrimSpace(cfg.Section("core").Key("chunkThreshold").String()); value != "" {
+		if threshold, err = media.ParseSize(value); err != nil {
+			return 0, fmt.Errorf("invalid core.chunkThreshold: %v", err)
+		}
+	}
+	chunkThresholds.Store(repoRoot, threshold)
+	return threshold, nil
+}
@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+)
+
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+type CommitObject struct {
+	Hash      string
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// String renders the signature the way it is stored in commit objects:
+// "Name <email> <unix seconds> <+hhmm>".
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
+
+func ParseSignature(line string) (Signature, error) {
+	lt := strings.Index(line, "<")
+	gt := strings.LastIndex(line, ">")
+	if lt < 0 || gt < lt {
+		return Signature{}, fmt.Errorf("malformed signature: %q", line)
+	}
+
+	sig := Signature{
+		Name:  strings.TrimSpace(line[:lt]),
+		Email: line[lt+1 : gt],
+	}
+
+	fields := strings.Fields(line[gt+1:])
+	if len(fields) < 1 {
+		return sig, nil
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("malformed signature timestamp: %q", line)
+	}
+	loc := time.UTC
+	if len(fields) > 1 {
+		if t, err := time.Parse("-0700", fields[1]); err == nil {
+			_, offset := t.Zone()
+			loc = time.FixedZone("", offset)
+		}
+	}
+	sig.When = time.Unix(secs, 0).In(loc)
+	return sig, nil
+}
+
+func ParseCommit(hash string, data []byte) (*CommitObject, error) {
+	commit := &CommitObject{Hash: hash}
+
+	header, msg, _ := bytes.Cut(data, []byte("\n\n"))
+	commit.Message = strings.TrimSuffix(string(msg), "\n")
+
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			sig, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			commit.Author = sig
+		case "committer":
+			sig, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			commit.Committer = sig
+		}
+	}
+
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("commit %s has no tree", hash)
+	}
+	return commit, nil
+}
+
+func ReadCommit(repoRoot, hash string) (*CommitObject, error) {
+	objType, data, err := objects.NewStore(repoRoot).Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "commit" {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, objType)
+	}
+	return ParseCommit(hash, data)
+}
+
+// IsAncestor reports whether ancestor is reachable from descendant by
+// following parent links. A commit counts as its own ancestor.
+func IsAncestor(repoRoot, ancestor, descendant string) (bool, error) {
+	if ancestor == "" || descendant == "" {
+		return false, nil
+	}
+	queue := []string{descendant}
+	seen := map[string]bool{descendant: true}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == ancestor {
+			return true, nil
+		}
+		commit, err := ReadCommit(repoRoot, hash)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range commit.Parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return false, nil
+}
+
+// MergeBase returns the best common ancestor of a and b, or "" if their
+// histories are unrelated. When several common ancestors qualify, the most
+// recently committed one that is not itself an ancestor of another wins.
+func MergeBase(repoRoot, a, b string) (string, error) {
+	bases, err := MergeBases(repoRoot, a, b)
+	if err != nil || len(bases) == 0 {
+		return "", err
+	}
+	return bases[0], nil
+}
+
+// MergeBases returns every common ancestor of a and b that is not itself an
+// ancestor of another one, most recently committed first. Criss-cross
+// merges leave more than one.
+func MergeBases(repoRoot, a, b string) ([]string, error) {
+	ancestorsOfA := map[string]bool{}
+	queue := []string{a}
+	ancestorsOfA[a] = true
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		commit, err := ReadCommit(repoRoot, hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range commit.Parents {
+			if !ancestorsOfA[p] {
+				ancestorsOfA[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	// Walk b's history, stopping at the first common commit on each path.
+	candidates := []*CommitObject{}
+	queue = []string{b}
+	seen := map[string]bool{b: true}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		commit, err := ReadCommit(repoRoot, hash)
+		if err != nil {
+			return nil, err
+		}
+		if ancestorsOfA[hash] {
+			candidates = append(candidates, commit)
+			continue
+		}
+		for _, p := range commit.Parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	bases := []*CommitObject{}
+	for _, c := range candidates {
+		redundant := false
+		for _, other := range candidates {
+			if other.Hash == c.Hash {
+				continue
+			}
+			isAnc, err := IsAncestor(repoRoot, c.Hash, other.Hash)
+			if err != nil {
+				return nil, err
+			}
+			if isAnc {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			bases = append(bases, c)
+		}
+	}
+	sort.SliceStable(bases, func(i, j int) bool {
+		return bases[i].Committer.When.After(bases[j].Committer.When)
+	})
+	hashes := make([]string, len(bases))
+	for i, c := range bases {
+		hashes[i] = c.Hash
+	}
+	return hashes, nil
+}
+
+// Ancestors returns every commit reachable from hash, hash included.
+func Ancestors(repoRoot, hash string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	if hash == "" {
+		return seen, nil
+	}
+	queue := []string{hash}
+	seen[hash] = true
+	for len(queue) > 0 {
+		commit, err := ReadCommit(repoRoot, queue[0])
+		queue = queue[1:]
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range commit.Parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// AheadBehind counts the commits reachable from local but not upstream
+// (ahead) and from upstream but not local (behind).
+func AheadBehind(repoRoot, local, upstream string) (ahead int, behind int, err error) {
+	localSet, err := Ancestors(repoRoot, local)
+	if err != nil {
+		return 0, 0, err
+	}
+	upstreamSet, err := Ancestors(repoRoot, upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	for h := range localSet {
+		if !upstreamSet[h] {
+			ahead++
+		}
+	}
+	for h := range upstreamSet {
+		if !localSet[h] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	"Mon Jan 2 15:04:05 2006 -0700",
+}
+
+var relativeUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// ParseDate understands absolute dates ("2024-05-01", RFC 3339, ...), raw
+// unix timestamps ("@1714521600" or "1714521600 +0200") and relative dates
+// such as "3 days ago", "yesterday" or "now".
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now := time.Now()
+
+	switch strings.ToLower(s) {
+	case "":
+		return time.Time{}, fmt.Errorf("empty date")
+	case "now":
+		return now, nil
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		y, m, d := now.AddDate(0, 0, -1).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	if len(fields) <= 2 {
+		if secs, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			t := time.Unix(secs, 0)
+			if len(fields) == 2 {
+				zone, err := time.Parse("-0700", fields[1])
+				if err != nil {
+					return time.Time{}, fmt.Errorf("invalid timezone offset %q", fields[1])
+				}
+				_, offset := zone.Zone()
+				t = t.In(time.FixedZone("", offset))
+			}
+			return t, nil
+		}
+	}
+
+	fields = strings.Fields(strings.ToLower(strings.ReplaceAll(s, ".", " ")))
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil {
+			if unit, ok := relativeUnits[strings.TrimSuffix(fields[1], "s")]; ok {
+				return now.Add(-time.Duration(n) * unit), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+const (
+	RoleAuthor    = "AUTHOR"
+	RoleCommitter = "COMMITTER"
+)
+
+// ResolveIdentity looks up the name and email for role (RoleAuthor or
+// RoleCommitter) in the repository config, then ~/.drift/config, then the
+// DRIFT_<ROLE>_NAME / DRIFT_<ROLE>_EMAIL environment variables. The
+// timestamp comes from DRIFT_<ROLE>_DATE when set, otherwise the current
+// local time.
+func ResolveIdentity(repoRoot, role string) (Signature, error) {
+	sig := Signature{}
+
+	homeDir, _ := os.UserHomeDir()
+	configPaths := []string{
+		filepath.Join(repoRoot, ".drift", "config"),
+		filepath.Join(homeDir, ".drift", "config"),
+	}
+	for _, path := range configPaths {
+		cfg, err := ini.LooseLoad(path)
+		if err != nil {
+			return sig, fmt.Errorf("error loading config %s: %v", path, err)
+		}
+		user := cfg.Section("user")
+		if sig.Name == "" {
+			sig.Name = strings.TrimSpace(user.Key("name").String())
+		}
+		if sig.Email == "" {
+			sig.Email = strings.TrimSpace(user.Key("email").String())
+		}
+	}
+	if sig.Name == "" {
+		sig.Name = strings.TrimSpace(os.Getenv("DRIFT_" + role + "_NAME"))
+	}
+	if sig.Email == "" {
+		sig.Email = strings.TrimSpace(os.Getenv("DRIFT_" + role + "_EMAIL"))
+	}
+
+	if sig.Name == "" || sig.Email == "" {
+		return sig, fmt.Errorf(
+			"%s identity unknown\n\n"+
+				"Please tell drift who you are. Run\n\n"+
+				"  drift config name \"Your Name\"\n"+
+				"  drift config email \"you@example.com\"\n\n"+
+				"to set it for this repository, or add --global to set it for every repository.",
+			strings.ToLower(role),
+		)
+	}
+
+	sig.When = time.Now()
+	if date := os.Getenv("DRIFT_" + role + "_DATE"); date != "" {
+		when, err := ParseDate(date)
+		if err != nil {
+			return sig, fmt.Errorf("invalid DRIFT_%s_DATE: %v", role, err)
+		}
+		sig.When = when
+	}
+
+	return sig, nil
+}
+
+// ParseIdent parses a "Name <email>" string as given to --author.
+func ParseIdent(s string) (Signature, error) {
+	lt := strings.Index(s, "<")
+	gt := strings.LastIndex(s, ">")
+	if lt < 0 || gt < lt {
+		return Signature{}, fmt.Errorf("identity %q is not in the form 'Name <email>'", s)
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(s[:lt]),
+		Email: strings.TrimSpace(s[lt+1 : gt]),
+	}
+	if sig.Name == "" || sig.Email == "" {
+		return Signature{}, fmt.Errorf("identity %q is missing a name or email", s)
+	}
+	return sig, nil
+}
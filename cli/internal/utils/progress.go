@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// progressThreshold is the file size from which drift add reports its
+// progress.
+const progressThreshold = 64 << 20
+
+// FormatSize renders a byte count with a binary unit, e.g. "1.5 MiB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressReader reports on stderr how much of a large file has been
+// read, redrawing one line a few times per second.
+type progressReader struct {
+	r     io.Reader
+	label string
+	total int64
+	done  int64
+	last  time.Time
+}
+
+func newProgressReader(r io.Reader, label string, total int64) *progressReader {
+	return &progressReader{r: r, label: label, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if time.Since(p.last) >= 200*time.Millisecond {
+		p.last = time.Now()
+		p.print("")
+	}
+	return n, err
+}
+
+func (p *progressReader) print(end string) {
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	fmt.Fprintf(os.Stderr, "\rAdding %s: %3d%% (%s / %s)%s",
+		p.label, percent, FormatSize(p.done), FormatSize(p.total), end)
+}
+
+// finish draws the final state and ends the line.
+func (p *progressReader) finish() {
+	p.print("\n")
+}
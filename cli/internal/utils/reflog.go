@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ZeroHash stands for "no commit" on either side of a reflog entry, as when
+// a branch is created.
+var ZeroHash = strings.Repeat("0", 64)
+
+// ReflogEntry is one line of .drift/log/<ref>:
+//
+//	<old> <new> Name <email> <unix seconds> <+hhmm>\t<message>
+type ReflogEntry struct {
+	Old     string
+	New     string
+	Who     Signature
+	Message string
+}
+
+func (e ReflogEntry) String() string {
+	return fmt.Sprintf("%s %s %s\t%s\n", e.Old, e.New, e.Who, e.Message)
+}
+
+func reflogPath(repoRoot, ref string) string {
+	return filepath.Join(repoRoot, ".drift", "log", filepath.FromSlash(ref))
+}
+
+// reflogIdentity is the committer identity, or a placeholder when none is
+// configured: a missing name must not stop a checkout.
+func reflogIdentity(repoRoot string) Signature {
+	sig, err := ResolveIdentity(repoRoot, RoleCommitter)
+	if err != nil {
+		return Signature{Name: "unknown", Email: "unknown", When: time.Now()}
+	}
+	return sig
+}
+
+// AppendReflog records that ref moved from old to new ("" for none on
+// either side).
+func AppendReflog(repoRoot, ref, old, new, message string) error {
+	if old == "" {
+		old = ZeroHash
+	}
+	if new == "" {
+		new = ZeroHash
+	}
+	message = strings.Join(strings.Fields(message), " ")
+	entry := ReflogEntry{Old: old, New: new, Who: reflogIdentity(repoRoot), Message: message}
+
+	path := reflogPath(repoRoot, ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory for %s: %v", ref, err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open reflog for %s: %v", ref, err)
+	}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write reflog for %s: %v", ref, err)
+	}
+	return f.Close()
+}
+
+// ReadReflog returns the entries recorded for ref, oldest first. A ref
+// without a reflog has no entries.
+func ReadReflog(repoRoot, ref string) ([]ReflogEntry, error) {
+	f, err := os.Open(reflogPath(repoRoot, ref))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reflog for %s: %v", ref, err)
+	}
+	defer f.Close()
+
+	entries := []ReflogEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		head, message, _ := strings.Cut(line, "\t")
+		fields := strings.SplitN(head, " ", 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed reflog entry for %s: %q", ref, line)
+		}
+		who, err := ParseSignature(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reflog entry for %s: %v", ref, err)
+		}
+		entries = append(entries, ReflogEntry{Old: fields[0], New: fields[1], Who: who, Message: message})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reflog for %s: %v", ref, err)
+	}
+	return entries, nil
+}
+
+// WriteReflog replaces the reflog of ref with entries.
+func WriteReflog(repoRoot, ref string, entries []ReflogEntry) error {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.String())
+	}
+	path := reflogPath(repoRoot, ref)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write reflog for %s: %v", ref, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write reflog for %s: %v", ref, err)
+	}
+	return nil
+}
+
+// RenameReflog moves the reflog of old to new, if there is one.
+func RenameReflog(repoRoot, old, new string) error {
+	from := reflogPath(repoRoot, old)
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return nil
+	}
+	to := reflogPath(repoRoot, new)
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory for %s: %v", new, err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to rename reflog of %s: %v", old, err)
+	}
+	RemoveEmptyDirs(filepath.Dir(from), filepath.Join(repoRoot, ".drift", "log"))
+	return nil
+}
+
+// DeleteReflog removes the reflog of ref, if there is one.
+func DeleteReflog(repoRoot, ref string) error {
+	path := reflogPath(repoRoot, ref)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete reflog for %s: %v", ref, err)
+	}
+	RemoveEmptyDirs(filepath.Dir(path), filepath.Join(repoRoot, ".drift", "log"))
+	return nil
+}
+
+// ListReflogs returns the refs that have a reflog, HEAD included.
+func ListReflogs(repoRoot string) ([]string, error) {
+	logDir := filepath.Join(repoRoot, ".drift", "log")
+	names := []string{}
+	err := filepath.WalkDir(logDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(logDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reflogs: %v", err)
+	}
+	return names, nil
+}
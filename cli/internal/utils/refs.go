@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/refs"
+)
+
+const (
+	BranchPrefix = "refs/heads/"
+	// RemotePrefix holds remote-tracking branches, one directory per peer:
+	// refs/remotes/<peer>/<branch>.
+	RemotePrefix = "refs/remotes/"
+)
+
+// ReadHead returns the ref HEAD points at ("" when HEAD is detached) and
+// the commit it resolves to ("" on a branch without commits).
+func ReadHead(repoRoot string) (ref string, hash string, err error) {
+	headData, err := os.ReadFile(filepath.Join(repoRoot, ".drift", "HEAD"))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read HEAD file: %v", err)
+	}
+	head := strings.TrimSpace(string(headData))
+	if !strings.HasPrefix(head, "ref: ") {
+		return "", head, nil
+	}
+
+	ref = strings.TrimPrefix(head, "ref: ")
+	hash, err = refs.Read(repoRoot, ref)
+	return ref, hash, err
+}
+
+// ResolveHead returns the commit HEAD points at, or "" when the current
+// branch has no commits yet.
+func ResolveHead(repoRoot string) (string, error) {
+	_, hash, err := ReadHead(repoRoot)
+	return hash, err
+}
+
+// CurrentBranch returns the short name of the checked out branch, or ""
+// when HEAD is detached.
+func CurrentBranch(repoRoot string) (string, error) {
+	ref, _, err := ReadHead(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(ref, BranchPrefix), nil
+}
+
+// CheckRefName rejects names that cannot be stored as a ref file or would
+// be confused with revision syntax.
+func CheckRefName(name string) error {
+	invalid := name == "" ||
+		name == "HEAD" ||
+		strings.HasPrefix(name, "-") ||
+		strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") ||
+		strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") ||
+		strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?*[\\\t\n")
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			invalid = true
+		}
+	}
+	if invalid {
+		return fmt.Errorf("'%s' is not a valid name", name)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs removes dir and its parents while they are empty,
+// stopping at stop.
+func RemoveEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
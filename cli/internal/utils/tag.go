@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
+)
+
+const TagPrefix = "refs/tags/"
+
+// TagObject is an annotated tag: a named, signed pointer to another object
+// with a message of its own.
+type TagObject struct {
+	Hash    string
+	Object  string
+	Type    string
+	Name    string
+	Tagger  Signature
+	Message string
+}
+
+// Bytes encodes the tag the way it is stored in the object database.
+func (t *TagObject) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", t.Object)
+	fmt.Fprintf(&buf, "type %s\n", t.Type)
+	fmt.Fprintf(&buf, "tag %s\n", t.Name)
+	fmt.Fprintf(&buf, "tagger %s\n", t.Tagger)
+	fmt.Fprintf(&buf, "\n%s\n", t.Message)
+	return buf.Bytes()
+}
+
+func ParseTag(hash string, data []byte) (*TagObject, error) {
+	tag := &TagObject{Hash: hash}
+
+	header, msg, _ := bytes.Cut(data, []byte("\n\n"))
+	tag.Message = strings.TrimSuffix(string(msg), "\n")
+
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			sig, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			tag.Tagger = sig
+		}
+	}
+
+	if tag.Object == "" || tag.Type == "" || tag.Name == "" {
+		return nil, fmt.Errorf("tag %s is missing its object, type or name", hash)
+	}
+	return tag, nil
+}
+
+// PeelTag follows annotated tags starting at hash until it reaches an
+// object that is not a tag, and returns that object's id and type.
+func PeelTag(repoRoot, hash string) (string, string, error) {
+	store := objects.NewStore(repoRoot)
+	// Tags of tags are legal, but a cycle is not; bound the chain.
+	for depth := 0; depth < 32; depth++ {
+		objType, data, err := store.Get(hash)
+		if err != nil {
+			return "", "", err
+		}
+		if objType != "tag" {
+			return hash, objType, nil
+		}
+		tag, err := ParseTag(hash, data)
+		if err != nil {
+			return "", "", err
+		}
+		hash = tag.Object
+	}
+	return "", "", fmt.Errorf("tag chain starting at %s is too deep", hash)
+}
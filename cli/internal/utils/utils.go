@@ -2,10 +2,8 @@ package utils
 
 import (
 	"bytes"
-	"compress/zlib"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -14,6 +12,9 @@ import (
 	// _libp2p "github.com/libp2p/go-libp2p"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
 	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sammanbajracharya/drift_cli/internal/index"
+	"github.com/sammanbajracharya/drift_cli/internal/media"
+	"github.com/sammanbajracharya/drift_cli/internal/objects"
 	"gopkg.in/ini.v1"
 )
 
@@ -61,72 +62,79 @@ func IsRepo() bool {
 	return false
 }
 
-func GetBlob(path string) ([]byte, error) {
-	content, err := os.ReadFile(path)
+// AddFile stores path as a blob and stages it in idx, replacing any entry
+// previously staged for the same path.
+func AddFile(path, repoRoot string, idx *index.Index) error {
+	info, err := os.Lstat(path)
 	if err != nil {
-		return nil, fmt.Errorf("Error reading file %s: %v", path, err)
+		return fmt.Errorf("Error reading file %s: %v", path, err)
 	}
-
-	header := fmt.Sprintf("blob %d\x00", len(content))
-	blob := append([]byte(header), content...)
-	return blob, nil
-}
-
-func AddFile(path, repoRoot string) error {
-	blob, err := GetBlob(path)
-	if err != nil {
-		return err
-	}
-	hashBytes := sha256.Sum256(blob)
-	hash := hex.EncodeToString(hashBytes[:])
+	mode := index.FileMode(info)
 
 	relPath, err := filepath.Rel(repoRoot, path)
 	if err != nil {
 		return fmt.Errorf("failed to get relative path: %v", err)
 	}
-	entry := fmt.Sprintf("100644 %s %s\n", hash, relPath)
-
-	indexPath := filepath.Join(".drift", "index")
-	existingIndex, err := os.ReadFile(indexPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Error reading index file: %v", err)
-	}
-	if bytes.Contains(existingIndex, []byte(entry)) {
+	relPath = filepath.ToSlash(relPath)
+	// Files whose stat data still matches their entry are already stored.
+	if e, ok := idx.Get(relPath); ok && e.Matches(info) && !idx.IsRacy(e) {
 		return nil
 	}
 
-	var compressed bytes.Buffer
-	w := zlib.NewWriter(&compressed)
-	_, err = w.Write(blob)
-	if err != nil {
-		return fmt.Errorf("Error compressing file %s: %v", path, err)
-	}
-	w.Close()
-
-	objectDir := filepath.Join(".drift", "objects", hash[:2])
-	objectPath := filepath.Join(objectDir, hash[2:])
-
-	if err := os.MkdirAll(objectDir, 0755); err != nil {
-		return fmt.Errorf("Error creating object directory %s: %v", objectDir, err)
-	}
-
-	if _, err := os.Stat(objectPath); os.IsNotExist(err) {
-		err = os.WriteFile(objectPath, compressed.Bytes(), 0644)
+	store := objects.NewStore(repoRoot)
+	var hash string
+	if mode == index.ModeSymlink {
+		// A symlink is stored as a blob holding its target, never followed.
+		target, err := os.Readlink(path)
 		if err != nil {
-			return fmt.Errorf("Error writing compressed file %s: %v", objectPath, err)
+			return fmt.Errorf("Error reading symlink %s: %v", path, err)
+		}
+		if hash, err = store.Put("blob", []byte(target)); err != nil {
+			return fmt.Errorf("Error storing file %s: %v", path, err)
+		}
+	} else {
+		mediaConfig, err := media.LoadConfig(repoRoot)
+		if err != nil {
+			return err
+		}
+		chunkThreshold, err := ChunkThreshold(repoRoot)
+		if err != nil {
+			return err
+		}
+		// Regular files are streamed, so their size is not bounded by
+		// memory.
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("Error reading file %s: %v", path, err)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		var progress *progressReader
+		if info.Size() >= progressThreshold {
+			progress = newProgressReader(f, relPath, info.Size())
+			r = progress
+		}
+		if mediaConfig.Matches(relPath, info.Size()) {
+			// Media content goes to the media store; the commit only
+			// carries a pointer to it.
+			var p media.Pointer
+			if p, err = media.NewStore(repoRoot).Put(r); err == nil {
+				hash, err = store.Put("blob", p.Bytes())
+			}
+		} else if chunkThreshold > 0 && info.Size() >= chunkThreshold {
+			hash, err = store.PutChunked(info.Size(), r)
+		} else {
+			hash, err = store.PutStream("blob", info.Size(), r)
+		}
+		if progress != nil {
+			progress.finish()
+		}
+		if err != nil {
+			return fmt.Errorf("Error storing file %s: %v", path, err)
 		}
 	}
 
-	f, err := os.OpenFile(indexPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("error opening index file: %v", err)
-	}
-	defer f.Close()
-
-	if _, err := f.WriteString(entry); err != nil {
-		return fmt.Errorf("error writing to index file: %v", err)
-	}
-
+	idx.Add(index.NewEntry(relPath, mode, hash, info))
 	return nil
 }
 
@@ -181,54 +189,77 @@ type TreeEntry struct {
 	Name string
 }
 
-func ParseIndex(data []byte) ([]TreeEntry, error) {
-	lines := bytes.Split(data, []byte("\n"))
+// IndexTreeEntries converts staged entries into the flat list BuildTree
+// expects.
+func IndexTreeEntries(idx *index.Index) []TreeEntry {
 	entries := []TreeEntry{}
-
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
-		parts := bytes.SplitN(line, []byte(" "), 3)
-		if len(parts) != 3 {
-			continue
-		}
-
+	for _, e := range idx.Entries() {
 		entries = append(entries, TreeEntry{
-			Mode: string(parts[0]),
+			Mode: e.Mode,
 			Type: "blob",
-			Hash: string(parts[1]),
-			Name: string(parts[2]),
+			Hash: e.Hash,
+			Name: e.Path,
 		})
 	}
+	return entries
+}
 
-	return entries, nil
+// treeNode is one directory level while turning a flat list of index paths
+// into nested tree objects.
+type treeNode struct {
+	files []TreeEntry
+	dirs  map[string]*treeNode
 }
 
+func newTreeNode() *treeNode {
+	return &treeNode{dirs: map[string]*treeNode{}}
+}
+
+// BuildTree writes tree objects for entries, whose names are paths relative
+// to the repository root, and returns the hash of the root tree. Every
+// directory level becomes its own tree, so the result only depends on the
+// set of paths and hashes, not on the order they are given in.
 func BuildTree(entries []TreeEntry, repoRoot string) (string, error) {
-	treeMap := map[string][]TreeEntry{}
+	root := newTreeNode()
 
 	for _, e := range entries {
-		parts := strings.SplitN(e.Name, string(os.PathSeparator), 2)
-		if len(parts) == 1 {
-			treeMap["."] = append(treeMap["."], e)
-		} else {
-			subdir := parts[0]
-			e.Name = parts[1]
-			treeMap[subdir] = append(treeMap[subdir], e)
+		parts := strings.Split(filepath.ToSlash(e.Name), "/")
+		node := root
+		for _, dir := range parts[:len(parts)-1] {
+			if dir == "" || dir == "." {
+				continue
+			}
+			child, ok := node.dirs[dir]
+			if !ok {
+				child = newTreeNode()
+				node.dirs[dir] = child
+			}
+			node = child
 		}
+		e.Name = parts[len(parts)-1]
+		node.files = append(node.files, e)
 	}
 
-	treeEntries := []TreeEntry{}
-	for _, e := range treeMap["."] {
+	return writeTreeNode(root, repoRoot)
+}
+
+func writeTreeNode(node *treeNode, repoRoot string) (string, error) {
+	treeEntries := make([]TreeEntry, 0, len(node.files)+len(node.dirs))
+	seen := map[string]bool{}
+
+	for _, e := range node.files {
+		if seen[e.Name] {
+			return "", fmt.Errorf("duplicate tree entry %q", e.Name)
+		}
+		seen[e.Name] = true
 		treeEntries = append(treeEntries, e)
 	}
 
-	for subdir, subEntries := range treeMap {
-		if subdir == "." {
-			continue
+	for name, child := range node.dirs {
+		if seen[name] {
+			return "", fmt.Errorf("%q is both a file and a directory", name)
 		}
-		subTreeHash, err := BuildTree(subEntries, repoRoot)
+		subTreeHash, err := writeTreeNode(child, repoRoot)
 		if err != nil {
 			return "", err
 		}
@@ -236,12 +267,90 @@ func BuildTree(entries []TreeEntry, repoRoot string) (string, error) {
 			Mode: "040000",
 			Type: "tree",
 			Hash: subTreeHash,
-			Name: subdir,
+			Name: name,
 		})
 	}
 
 	treeData := SerializeTree(treeEntries)
-	return WriteObject(repoRoot, "tree", treeData)
+	return objects.NewStore(repoRoot).Put("tree", treeData)
+}
+
+func ParseTree(data []byte) ([]TreeEntry, error) {
+	entries := []TreeEntry{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		parts := bytes.SplitN(line, []byte(" "), 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("malformed tree entry %q", line)
+		}
+		entries = append(entries, TreeEntry{
+			Mode: string(parts[0]),
+			Type: string(parts[1]),
+			Hash: string(parts[2]),
+			Name: string(parts[3]),
+		})
+	}
+	return entries, nil
+}
+
+func ReadTree(repoRoot, hash string) ([]TreeEntry, error) {
+	objType, data, err := objects.NewStore(repoRoot).Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "tree" {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", hash, objType)
+	}
+	return ParseTree(data)
+}
+
+// ValidTreeName reports whether name can be a tree entry: a single path
+// component that stays inside the working tree and outside .drift.
+func ValidTreeName(name string) bool {
+	return name != "" && name != "." && name != ".." && name != ".drift" &&
+		!strings.ContainsAny(name, "/\x00")
+}
+
+// FlattenTree walks a tree recursively and returns its blob entries keyed
+// by slash-separated path.
+func FlattenTree(repoRoot, hash string) (map[string]TreeEntry, error) {
+	files := map[string]TreeEntry{}
+	var walk func(hash, prefix string) error
+	walk = func(hash, prefix string) error {
+		entries, err := ReadTree(repoRoot, hash)
+		if err != nil {
+			return err
+		}
+		// A name used twice, such as a file and a directory both called
+		// "a", cannot be checked out: one would be written through the
+		// other.
+		seen := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			if !ValidTreeName(e.Name) {
+				return fmt.Errorf("tree %s has an entry with invalid name %q", hash, e.Name)
+			}
+			if seen[e.Name] {
+				return fmt.Errorf("tree %s has more than one entry named %q", hash, e.Name)
+			}
+			seen[e.Name] = true
+			name := prefix + e.Name
+			if e.Type == "tree" {
+				if err := walk(e.Hash, name+"/"); err != nil {
+					return err
+				}
+				continue
+			}
+			e.Name = name
+			files[name] = e
+		}
+		return nil
+	}
+	if err := walk(hash, ""); err != nil {
+		return nil, err
+	}
+	return files, nil
 }
 
 func SerializeTree(entries []TreeEntry) []byte {
@@ -256,26 +365,3 @@ func SerializeTree(entries []TreeEntry) []byte {
 	}
 	return buf.Bytes()
 }
-
-func WriteObject(repoRoot string, objType string, content []byte) (string, error) {
-	hdr := []byte(fmt.Sprintf("%s %d\x00", objType, len(content)))
-	obj := append(hdr, content...)
-	sum := sha256.Sum256(obj)
-	id := hex.EncodeToString(sum[:])
-	dir := filepath.Join(repoRoot, ".drift", "objects", id[:2])
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("Error creating object directory %s: %v", dir, err)
-	}
-	path := filepath.Join(dir, id[2:])
-	if _, err := os.Stat(path); err == nil {
-		return id, nil
-	}
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, obj, 0644); err != nil {
-		return "", fmt.Errorf("Error writing object file %s: %v", tmp, err)
-	}
-	if err := os.Rename(tmp, path); err != nil {
-		return "", fmt.Errorf("Error renaming object file %s to %s: %v", tmp, path, err)
-	}
-	return id, nil
-}